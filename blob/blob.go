@@ -28,6 +28,9 @@ type Blob struct {
 	diff  []float64
 	shape []int64
 	cap   int64
+
+	// pool the data is allocated from, nil for blobs created by New
+	pool *Pool
 }
 
 // New returns Blob from input shape
@@ -157,6 +160,30 @@ func (b *Blob) AxesNum() int {
 	return len(b.shape)
 }
 
+// CanonicalAxisIndex returns the axis index in [0, AxesNum()), negative axes
+// count from the last axis, e.g. -1 is the last axis
+func (b *Blob) CanonicalAxisIndex(axis int) (int, error) {
+	if axis < -b.AxesNum() || axis >= b.AxesNum() {
+		return 0, fmt.Errorf("axis %d out of range for %d-D blob with shape %v", axis, b.AxesNum(), b.shape)
+	}
+	if axis < 0 {
+		return axis + b.AxesNum(), nil
+	}
+
+	return axis, nil
+}
+
+// CountRange returns the product of the shape from axis start to axis end
+// excluded
+func (b *Blob) CountRange(start, end int) int64 {
+	count := int64(1)
+	for i := start; i < end; i++ {
+		count *= b.shape[i]
+	}
+
+	return count
+}
+
 // Num returns number of legacy shape
 func (b *Blob) Num() int64 {
 	return b.LegacyShape(0)
@@ -182,18 +209,28 @@ func (b *Blob) Capacity() int64 {
 	return b.cap
 }
 
+// Data returns the underlying data of the blob in row-major order, changes to
+// the returned slice modify the blob
+func (b *Blob) Data() []float64 {
+	return b.data
+}
+
 // LegacyShape return index shape in the legacy
 func (b *Blob) LegacyShape(index int) int64 {
 	if b.AxesNum() > 4 {
 		panic("cannot use legacy accessors on Blobs with > 4 axes.")
 	}
-	if index > 4 && index < -4 {
-		panic("index is not in [-4, 4]")
+	if index >= 4 || index < -4 {
+		panic("index is not in [-4, 4)")
 	}
 
-	if index > b.AxesNum() || index < -b.AxesNum() {
+	// missing axes of the legacy 4 axes have size 1
+	if index >= b.AxesNum() || index < -b.AxesNum() {
 		return 1
 	}
+	if index < 0 {
+		index += b.AxesNum()
+	}
 
 	return b.shape[index]
 }
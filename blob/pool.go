@@ -0,0 +1,117 @@
+package blob
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool recycles the storage of blobs which are no longer used, so that a new
+// blob can reuse the data of a released one instead of allocating. Blobs from
+// a pool have no diff. A Pool is safe for concurrent use
+type Pool struct {
+	mu        sync.Mutex
+	free      [][]float64
+	allocated int64
+}
+
+// NewPool returns an empty pool
+func NewPool() *Pool {
+	return &Pool{}
+}
+
+// New returns a zeroed blob of the shape, backed by the smallest released
+// buffer large enough, or by a new buffer
+func (p *Pool) New(shape []int64) (*Blob, error) {
+	if len(shape) > maxBlobAxes {
+		return nil, ErrExceedMaxAxes
+	}
+
+	cap := int64(1)
+	for _, v := range shape {
+		if v < 0 {
+			return nil, ErrInvalidShape
+		}
+		if v == 0 {
+			continue
+		}
+		cap *= v
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best := -1
+	for i, buf := range p.free {
+		if int64(len(buf)) >= cap && (best < 0 || len(buf) < len(p.free[best])) {
+			best = i
+		}
+	}
+
+	var data []float64
+	if best < 0 {
+		data = make([]float64, cap)
+		p.allocated += cap
+	} else {
+		data = p.free[best][:cap]
+		p.free = append(p.free[:best], p.free[best+1:]...)
+		for i := range data {
+			data[i] = 0
+		}
+	}
+
+	return &Blob{
+		data:  data,
+		shape: shape,
+		cap:   cap,
+		pool:  p,
+	}, nil
+}
+
+// Release gives the storage of the blob back to the pool, the blob must not
+// be used afterwards. Blobs not allocated by the pool are ignored
+func (p *Pool) Release(b *Blob) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if b == nil || b.pool != p {
+		return
+	}
+
+	b.pool = nil
+	p.free = append(p.free, b.data[:cap(b.data)])
+	b.data = nil
+}
+
+// Allocated returns the number of float64 values allocated by the pool
+func (p *Pool) Allocated() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.allocated
+}
+
+type poolKey struct{}
+
+// WithPool returns a context carrying the pool, blobs created by NewContext
+// with the returned context are allocated from the pool
+func WithPool(ctx context.Context, p *Pool) context.Context {
+	return context.WithValue(ctx, poolKey{}, p)
+}
+
+// NewContext returns a blob of the shape, allocated from the pool of the
+// context if any
+func NewContext(ctx context.Context, shape []int64) (*Blob, error) {
+	if p, ok := ctx.Value(poolKey{}).(*Pool); ok {
+		return p.New(shape)
+	}
+
+	return New(shape)
+}
+
+// ReleaseContext gives the storage of the blob back to the pool of the
+// context, if any, for temporary blobs created by NewContext
+func ReleaseContext(ctx context.Context, b *Blob) {
+	if p, ok := ctx.Value(poolKey{}).(*Pool); ok {
+		p.Release(b)
+	}
+}
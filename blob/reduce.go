@@ -0,0 +1,107 @@
+package blob
+
+import (
+	"fmt"
+	"math"
+)
+
+// ReduceOp is an operation reducing many values to one
+type ReduceOp int
+
+const (
+	// ReduceSum sums the values
+	ReduceSum ReduceOp = iota
+	// ReduceAsum sums the absolute values
+	ReduceAsum
+	// ReduceSumSq sums the squared values
+	ReduceSumSq
+	// ReduceMean averages the values
+	ReduceMean
+)
+
+func (op ReduceOp) String() string {
+	switch op {
+	case ReduceSum:
+		return "SUM"
+	case ReduceAsum:
+		return "ASUM"
+	case ReduceSumSq:
+		return "SUMSQ"
+	case ReduceMean:
+		return "MEAN"
+	}
+
+	return fmt.Sprintf("ReduceOp(%d)", int(op))
+}
+
+// Reduce returns the blob of shape Shape()[:axis] holding the reduction of
+// the values over all axes from axis onwards, a negative axis counting from
+// the last axis. Reducing from axis 0 returns a scalar blob
+func (b *Blob) Reduce(op ReduceOp, axis int) (*Blob, error) {
+	axis, err := b.CanonicalAxisIndex(axis)
+	if err != nil {
+		return nil, err
+	}
+
+	shape := make([]int64, axis)
+	copy(shape, b.shape[:axis])
+	result, err := New(shape)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.ReduceInto(result, op, axis); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ReduceInto is Reduce writing the reduction into dst, which must hold one
+// value for every index of the axes before axis
+func (b *Blob) ReduceInto(dst *Blob, op ReduceOp, axis int) error {
+	axis, err := b.CanonicalAxisIndex(axis)
+	if err != nil {
+		return err
+	}
+
+	num := int(b.CountRange(0, axis))
+	if len(dst.data) != num {
+		return fmt.Errorf("reduce shape %v from axis %d into %d values, expect %d", b.shape, axis, len(dst.data), num)
+	}
+
+	dim := int(b.CountRange(axis, b.AxesNum()))
+	for i := 0; i < num; i++ {
+		value, err := reduce(op, b.data[i*dim:(i+1)*dim])
+		if err != nil {
+			return err
+		}
+		dst.data[i] = value
+	}
+
+	return nil
+}
+
+func reduce(op ReduceOp, data []float64) (float64, error) {
+	result := 0.0
+	switch op {
+	case ReduceSum, ReduceMean:
+		for _, v := range data {
+			result += v
+		}
+		if op == ReduceMean && len(data) > 0 {
+			result /= float64(len(data))
+		}
+	case ReduceAsum:
+		for _, v := range data {
+			result += math.Abs(v)
+		}
+	case ReduceSumSq:
+		for _, v := range data {
+			result += v * v
+		}
+	default:
+		return 0, fmt.Errorf("unknown reduction operation %s", op)
+	}
+
+	return result, nil
+}
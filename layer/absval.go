@@ -0,0 +1,26 @@
+package layer
+
+import (
+	"context"
+	"math"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// AbsValLayer computes the absolute value y = |x|
+type AbsValLayer struct {
+	neuron
+}
+
+func NewAbsValLayer(param *pb.LayerParameter) (*AbsValLayer, error) {
+	return &AbsValLayer{neuron: newNeuron(param)}, nil
+}
+
+func (abs *AbsValLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return abs.ForwardContext(context.Background(), bottom)
+}
+
+func (abs *AbsValLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return abs.forward(ctx, bottom, math.Abs)
+}
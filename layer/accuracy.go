@@ -0,0 +1,140 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// AccuracyLayer computes the classification accuracy of the predictions in
+// the first bottom for the labels in the second bottom, as
+// accuracy_layer.cpp. A prediction is correct when the true label is among
+// the top_k scoring classes along axis. With a second top, it also computes
+// the accuracy of every class
+type AccuracyLayer struct {
+	topK           int
+	axis           int
+	hasIgnoreLabel bool
+	ignoreLabel    int
+	bottom         []string
+	top            []string
+	name           string
+}
+
+func NewAccuracyLayer(param *pb.LayerParameter) (*AccuracyLayer, error) {
+	if len(param.GetBottom()) != 2 {
+		return nil, fmt.Errorf("create accuracy layer %s fail, %d bottoms, expect predictions and labels", param.GetName(), len(param.GetBottom()))
+	}
+
+	accuracyParam := param.GetAccuracyParam()
+	return &AccuracyLayer{
+		topK:           int(accuracyParam.GetTopK()),
+		axis:           int(accuracyParam.GetAxis()),
+		hasIgnoreLabel: accuracyParam != nil && accuracyParam.IgnoreLabel != nil,
+		ignoreLabel:    int(accuracyParam.GetIgnoreLabel()),
+		bottom:         param.GetBottom(),
+		top:            param.GetTop(),
+		name:           param.GetName(),
+	}, nil
+}
+
+func (accuracy *AccuracyLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return accuracy.ForwardContext(context.Background(), bottom)
+}
+
+func (accuracy *AccuracyLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	if len(bottom) != 2 {
+		return nil, fmt.Errorf("accuracy layer %s: %d bottoms, expect predictions and labels", accuracy.name, len(bottom))
+	}
+
+	axis, err := bottom[0].CanonicalAxisIndex(accuracy.axis)
+	if err != nil {
+		return nil, fmt.Errorf("accuracy layer %s: %s", accuracy.name, err)
+	}
+	outer := int(bottom[0].CountRange(0, axis))
+	inner := int(bottom[0].CountRange(axis+1, bottom[0].AxesNum()))
+	numLabels := int(bottom[0].ShapeOfIndex(axis))
+	if accuracy.topK > numLabels {
+		return nil, fmt.Errorf("accuracy layer %s: top_k %d larger than the %d classes", accuracy.name, accuracy.topK, numLabels)
+	}
+	if int(bottom[1].Capacity()) != outer*inner {
+		return nil, fmt.Errorf("accuracy layer %s: %d labels for predictions shape %v, expect %d", accuracy.name, bottom[1].Capacity(), bottom[0].Shape(), outer*inner)
+	}
+
+	predictions := bottom[0].Data()
+	labels := bottom[1].Data()
+	dim := numLabels * inner
+	correct, count := 0, 0
+	classCorrect := make([]int, numLabels)
+	classCount := make([]int, numLabels)
+	for i := 0; i < outer; i++ {
+		for j := 0; j < inner; j++ {
+			label := int(labels[i*inner+j])
+			if accuracy.hasIgnoreLabel && label == accuracy.ignoreLabel {
+				continue
+			}
+			if label < 0 || label >= numLabels {
+				return nil, fmt.Errorf("accuracy layer %s: label %d out of the %d classes", accuracy.name, label, numLabels)
+			}
+			classCount[label]++
+
+			// the true class is among the top k when less than k other
+			// classes score at least as high
+			prob := predictions[i*dim+label*inner+j]
+			better := -1
+			for k := 0; k < numLabels; k++ {
+				if predictions[i*dim+k*inner+j] >= prob {
+					better++
+				}
+			}
+			if better < accuracy.topK {
+				correct++
+				classCorrect[label]++
+			}
+			count++
+		}
+	}
+
+	top := make([]*blob.Blob, 0, 2)
+	t, err := newTop(ctx, []int64{})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		t.Data()[0] = float64(correct) / float64(count)
+	}
+	top = append(top, t)
+
+	if len(accuracy.top) > 1 {
+		perClass, err := newTop(ctx, []int64{int64(numLabels)})
+		if err != nil {
+			return nil, err
+		}
+		data := perClass.Data()
+		for c := range data {
+			if classCount[c] > 0 {
+				data[c] = float64(classCorrect[c]) / float64(classCount[c])
+			}
+		}
+		top = append(top, perClass)
+	}
+
+	log.Println(accuracy.Type(), bottom[0].Shape(), "accuracy", top[0].Data()[0])
+
+	return top, nil
+}
+
+func (accuracy *AccuracyLayer) Type() string {
+	return accuracy.name
+}
+
+func (accuracy *AccuracyLayer) Bottom() []string {
+	return accuracy.bottom
+}
+
+func (accuracy *AccuracyLayer) Top() []string {
+	return accuracy.top
+}
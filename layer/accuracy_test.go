@@ -0,0 +1,103 @@
+package layer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestAccuracyLayer(t *testing.T) {
+	// 4 predictions over 3 classes
+	predictions := []float64{
+		0.1, 0.7, 0.2,
+		0.5, 0.3, 0.2,
+		0.2, 0.3, 0.5,
+		0.6, 0.1, 0.3,
+	}
+	labels := []float64{1, 1, 2, 2}
+	tests := []struct {
+		param    *pb.AccuracyParameter
+		accuracy float64
+		perClass []float64
+	}{
+		{nil, 0.5, []float64{0, 0.5, 0.5}},
+		{&pb.AccuracyParameter{TopK: proto.Uint32(2)}, 1, []float64{0, 1, 1}},
+		{&pb.AccuracyParameter{IgnoreLabel: proto.Int32(2)}, 0.5, []float64{0, 0.5, 0}},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:          proto.String("accuracy"),
+			Type:          proto.String("ACCURACY"),
+			Bottom:        []string{"prob", "label"},
+			Top:           []string{"accuracy", "per_class"},
+			AccuracyParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bottom, err := blob.New([]int64{4, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(bottom.Data(), predictions)
+		label, err := blob.New([]int64{4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(label.Data(), labels)
+
+		top, err := l.Forward([]*blob.Blob{bottom, label})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := top[0].Data()[0]; math.Abs(v-test.accuracy) > 1e-9 {
+			t.Fatalf("test %d: accuracy %f, expect %f", i, v, test.accuracy)
+		}
+		if !equalData(top[1].Data(), test.perClass) {
+			t.Fatalf("test %d: per class accuracy %v, expect %v", i, top[1].Data(), test.perClass)
+		}
+	}
+}
+
+func TestAccuracyLayerAxis(t *testing.T) {
+	// 1 image of 2 classes x 2 positions, labels per position
+	l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name:   proto.String("accuracy"),
+		Type:   proto.String("Accuracy"),
+		Bottom: []string{"score", "label"},
+		Top:    []string{"accuracy"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bottom, err := blob.New([]int64{1, 2, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(bottom.Data(), []float64{0.9, 0.2, 0.1, 0.8})
+	label, err := blob.New([]int64{1, 1, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(label.Data(), []float64{0, 0})
+
+	top, err := l.Forward([]*blob.Blob{bottom, label})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 1 || top[0].Data()[0] != 0.5 {
+		t.Fatalf("top %v, expect accuracy 0.5 only", top)
+	}
+
+	copy(label.Data(), []float64{0, 2})
+	if _, err := l.Forward([]*blob.Blob{bottom, label}); err == nil {
+		t.Fatal("expect error for label 2 out of 2 classes")
+	}
+}
@@ -0,0 +1,138 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// ArgMaxLayer computes the index of the top_k largest values of every image,
+// or along axis when set, as argmax_layer.cpp. With out_max_val the values are
+// returned with the indices, or instead of them along an axis. Equal values
+// are ordered by decreasing index, as Caffe orders them
+type ArgMaxLayer struct {
+	outMaxVal bool
+	topK      int
+	hasAxis   bool
+	axis      int
+	bottom    []string
+	top       []string
+	name      string
+}
+
+func NewArgMaxLayer(param *pb.LayerParameter) (*ArgMaxLayer, error) {
+	argmaxParam := param.GetArgmaxParam()
+	if argmaxParam.GetTopK() < 1 {
+		return nil, fmt.Errorf("create argmax layer %s fail, top_k must be >= 1", param.GetName())
+	}
+
+	return &ArgMaxLayer{
+		outMaxVal: argmaxParam.GetOutMaxVal(),
+		topK:      int(argmaxParam.GetTopK()),
+		hasAxis:   argmaxParam != nil && argmaxParam.Axis != nil,
+		axis:      int(argmaxParam.GetAxis()),
+		bottom:    param.GetBottom(),
+		top:       param.GetTop(),
+		name:      param.GetName(),
+	}, nil
+}
+
+func (argmax *ArgMaxLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return argmax.ForwardContext(context.Background(), bottom)
+}
+
+func (argmax *ArgMaxLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	// the values compared are dim values axisDist apart, for num positions
+	var shape []int64
+	var dim, axisDist int
+	if argmax.hasAxis {
+		axis, err := bottom[0].CanonicalAxisIndex(argmax.axis)
+		if err != nil {
+			return nil, fmt.Errorf("argmax layer %s: %s", argmax.name, err)
+		}
+		shape = make([]int64, bottom[0].AxesNum())
+		copy(shape, bottom[0].Shape())
+		shape[axis] = int64(argmax.topK)
+		dim = int(bottom[0].ShapeOfIndex(axis))
+		axisDist = int(bottom[0].CountRange(axis+1, bottom[0].AxesNum()))
+	} else {
+		axes := bottom[0].AxesNum()
+		if axes < 3 {
+			axes = 3
+		}
+		shape = make([]int64, axes)
+		for i := range shape {
+			shape[i] = 1
+		}
+		shape[0] = bottom[0].ShapeOfIndex(0)
+		shape[2] = int64(argmax.topK)
+		if argmax.outMaxVal {
+			shape[1] = 2
+		}
+		dim = int(bottom[0].CountRange(1, bottom[0].AxesNum()))
+		axisDist = 1
+	}
+	if argmax.topK > dim {
+		return nil, fmt.Errorf("argmax layer %s: top_k %d larger than %d values of bottom shape %v", argmax.name, argmax.topK, dim, bottom[0].Shape())
+	}
+
+	top, err := newTop(ctx, shape)
+	if err != nil {
+		return nil, err
+	}
+
+	src := bottom[0].Data()
+	data := top.Data()
+	num := 0
+	if dim > 0 {
+		num = int(bottom[0].Capacity()) / dim
+	}
+	index := make([]int, dim)
+	for i := 0; i < num; i++ {
+		base := i/axisDist*dim*axisDist + i%axisDist
+		for j := range index {
+			index[j] = j
+		}
+		sort.Slice(index, func(a, b int) bool {
+			va, vb := src[base+index[a]*axisDist], src[base+index[b]*axisDist]
+			if va != vb {
+				return va > vb
+			}
+			return index[a] > index[b]
+		})
+
+		for j := 0; j < argmax.topK; j++ {
+			value := src[base+index[j]*axisDist]
+			switch {
+			case argmax.hasAxis && argmax.outMaxVal:
+				data[i/axisDist*argmax.topK*axisDist+j*axisDist+i%axisDist] = value
+			case argmax.hasAxis:
+				data[i/axisDist*argmax.topK*axisDist+j*axisDist+i%axisDist] = float64(index[j])
+			case argmax.outMaxVal:
+				data[2*i*argmax.topK+j] = float64(index[j])
+				data[2*i*argmax.topK+argmax.topK+j] = value
+			default:
+				data[i*argmax.topK+j] = float64(index[j])
+			}
+		}
+	}
+
+	logForward(argmax.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+func (argmax *ArgMaxLayer) Type() string {
+	return argmax.name
+}
+
+func (argmax *ArgMaxLayer) Bottom() []string {
+	return argmax.bottom
+}
+
+func (argmax *ArgMaxLayer) Top() []string {
+	return argmax.top
+}
@@ -0,0 +1,61 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestArgMaxLayer(t *testing.T) {
+	// two images of 2 channels x 3 positions, with ties in the first image
+	values := []float64{
+		1, 5, 2,
+		3, 5, 0,
+
+		-1, 4, 7,
+		6, -2, 7,
+	}
+	tests := []struct {
+		param *pb.ArgMaxParameter
+		shape []int64
+		data  []float64
+	}{
+		{nil, []int64{2, 1, 1}, []float64{4, 5}},
+		{&pb.ArgMaxParameter{TopK: proto.Uint32(3)}, []int64{2, 1, 3}, []float64{4, 1, 3, 5, 2, 3}},
+		{&pb.ArgMaxParameter{OutMaxVal: proto.Bool(true), TopK: proto.Uint32(2)}, []int64{2, 2, 2}, []float64{4, 1, 5, 5, 5, 2, 7, 7}},
+		// label map along the channel axis
+		{&pb.ArgMaxParameter{Axis: proto.Int32(1)}, []int64{2, 1, 3}, []float64{1, 1, 0, 1, 0, 1}},
+		{&pb.ArgMaxParameter{Axis: proto.Int32(1), OutMaxVal: proto.Bool(true)}, []int64{2, 1, 3}, []float64{3, 5, 2, 6, 4, 7}},
+		{&pb.ArgMaxParameter{Axis: proto.Int32(-1), TopK: proto.Uint32(2)}, []int64{2, 2, 2}, []float64{1, 2, 1, 0, 2, 1, 2, 0}},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:        proto.String("argmax"),
+			Type:        proto.String("ARGMAX"),
+			ArgmaxParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bottom, err := blob.New([]int64{2, 2, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(bottom.Data(), values)
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Fatalf("test %d: top shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Fatalf("test %d: top %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// BatchNormLayer normalizes every channel of the bottom to zero mean and unit
+// variance, as batch_norm_layer.cpp. With use_global_stats, the default for
+// inference, it uses the mean and variance stored in its blobs, which are
+// divided by the moving average scale factor stored in the third blob.
+// Otherwise it uses the statistics of the bottom itself
+type BatchNormLayer struct {
+	useGlobalStats bool
+	eps            float64
+	// mean, variance and moving average scale factor
+	mean     *blob.Blob
+	variance *blob.Blob
+	factor   *blob.Blob
+	bottom   []string
+	top      []string
+	name     string
+}
+
+func NewBatchNormLayer(param *pb.LayerParameter) (*BatchNormLayer, error) {
+	bnParam := param.GetBatchNormParam()
+
+	// the statistics are only computed from the bottom when asked for, the
+	// net always runs in the test phase
+	useGlobalStats := true
+	if bnParam != nil && bnParam.UseGlobalStats != nil {
+		useGlobalStats = bnParam.GetUseGlobalStats()
+	}
+
+	bn := &BatchNormLayer{
+		useGlobalStats: useGlobalStats,
+		eps:            float64(bnParam.GetEps()),
+		bottom:         param.GetBottom(),
+		top:            param.GetTop(),
+		name:           param.GetName(),
+	}
+
+	blobprotos := param.GetBlobs()
+	if len(blobprotos) == 0 {
+		return bn, nil
+	}
+	if len(blobprotos) != 3 {
+		return nil, fmt.Errorf("create batch norm layer %s fail, %d blobs, expect mean, variance and scale factor", param.GetName(), len(blobprotos))
+	}
+	blobs := make([]*blob.Blob, len(blobprotos))
+	for i, v := range blobprotos {
+		b, err := blob.FromProto(v)
+		if err != nil {
+			return nil, err
+		}
+		blobs[i] = b
+	}
+	if blobs[0].Capacity() != blobs[1].Capacity() || blobs[2].Capacity() != 1 {
+		return nil, fmt.Errorf("create batch norm layer %s fail, mean %v, variance %v and scale factor %v shapes mismatch", param.GetName(), blobs[0].Shape(), blobs[1].Shape(), blobs[2].Shape())
+	}
+	bn.mean, bn.variance, bn.factor = blobs[0], blobs[1], blobs[2]
+
+	return bn, nil
+}
+
+func (bn *BatchNormLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return bn.ForwardContext(context.Background(), bottom)
+}
+
+func (bn *BatchNormLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	num := int(bottom[0].ShapeOfIndex(0))
+	channels := 1
+	if bottom[0].AxesNum() > 1 {
+		channels = int(bottom[0].ShapeOfIndex(1))
+	}
+	spatial := 0
+	if num*channels > 0 {
+		spatial = int(bottom[0].Capacity()) / (num * channels)
+	}
+	src := bottom[0].Data()
+
+	var mean, variance []float64
+	if bn.useGlobalStats {
+		if bn.mean == nil {
+			return nil, fmt.Errorf("batch norm layer %s: no statistics, copy the trained layers or init the blobs first", bn.name)
+		}
+		if int(bn.mean.Capacity()) != channels {
+			return nil, fmt.Errorf("batch norm layer %s: %d statistics for bottom shape %v with %d channels", bn.name, bn.mean.Capacity(), bottom[0].Shape(), channels)
+		}
+
+		factor := bn.factor.Data()[0]
+		if factor != 0 {
+			factor = 1 / factor
+		}
+		mean = make([]float64, channels)
+		variance = make([]float64, channels)
+		for c := 0; c < channels; c++ {
+			mean[c] = bn.mean.Data()[c] * factor
+			variance[c] = bn.variance.Data()[c] * factor
+		}
+	} else {
+		mean, variance = channelStats(src, num, channels, spatial)
+	}
+
+	top, err := newTop(ctx, bottom[0].Shape())
+	if err != nil {
+		return nil, err
+	}
+	data := top.Data()
+	for c := 0; c < channels; c++ {
+		std := math.Sqrt(variance[c] + bn.eps)
+		for n := 0; n < num; n++ {
+			offset := (n*channels + c) * spatial
+			for s := offset; s < offset+spatial; s++ {
+				data[s] = (src[s] - mean[c]) / std
+			}
+		}
+	}
+
+	logForward(bn.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+// channelStats returns the mean and variance of every channel over the batch
+// and spatial axes
+func channelStats(data []float64, num, channels, spatial int) ([]float64, []float64) {
+	mean := make([]float64, channels)
+	variance := make([]float64, channels)
+	count := float64(num * spatial)
+	if count == 0 {
+		return mean, variance
+	}
+
+	for c := 0; c < channels; c++ {
+		for n := 0; n < num; n++ {
+			offset := (n*channels + c) * spatial
+			for s := offset; s < offset+spatial; s++ {
+				mean[c] += data[s]
+			}
+		}
+		mean[c] /= count
+
+		for n := 0; n < num; n++ {
+			offset := (n*channels + c) * spatial
+			for s := offset; s < offset+spatial; s++ {
+				d := data[s] - mean[c]
+				variance[c] += d * d
+			}
+		}
+		variance[c] /= count
+	}
+
+	return mean, variance
+}
+
+// InitBlobs sets the statistics not loaded from a trained model to zero mean
+// and unit variance, so that the layer only divides by sqrt(1 + eps)
+func (bn *BatchNormLayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	if bn.mean == nil {
+		channels := int64(1)
+		if bottom[0].AxesNum() > 1 {
+			channels = bottom[0].ShapeOfIndex(1)
+		}
+
+		var err error
+		if bn.mean, err = blob.New([]int64{channels}); err != nil {
+			return nil, err
+		}
+		if bn.variance, err = blob.Init([]int64{channels}, 1); err != nil {
+			return nil, err
+		}
+		if bn.factor, err = blob.Init([]int64{1}, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return []*blob.Blob{bn.mean, bn.variance, bn.factor}, nil
+}
+
+func (bn *BatchNormLayer) Type() string {
+	return bn.name
+}
+
+func (bn *BatchNormLayer) Bottom() []string {
+	return bn.bottom
+}
+
+func (bn *BatchNormLayer) Top() []string {
+	return bn.top
+}
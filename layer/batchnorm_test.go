@@ -0,0 +1,76 @@
+package layer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestBatchNormLayerGlobalStats(t *testing.T) {
+	mean := []float32{2, -4}
+	variance := []float32{8, 2}
+	factor := float32(2)
+	l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name: proto.String("bn"),
+		Type: proto.String("BatchNorm"),
+		Blobs: []*pb.BlobProto{
+			{Shape: &pb.BlobShape{Dim: []int64{2}}, Data: mean},
+			{Shape: &pb.BlobShape{Dim: []int64{2}}, Data: variance},
+			{Shape: &pb.BlobShape{Dim: []int64{1}}, Data: []float32{factor}},
+		},
+		BatchNormParam: &pb.BatchNormParameter{Eps: proto.Float32(0.5)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bottom := rangeBlob(t, []int64{2, 2, 1, 3}, -5)
+	top, err := l.Forward([]*blob.Blob{bottom})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range top[0].Data() {
+		c := (i / 3) % 2
+		expect := (bottom.Data()[i] - float64(mean[c]/factor)) / math.Sqrt(float64(variance[c]/factor)+0.5)
+		if math.Abs(v-expect) > 1e-6 {
+			t.Fatalf("top %v at %d, expect %f", top[0].Data(), i, expect)
+		}
+	}
+}
+
+func TestBatchNormLayerBatchStats(t *testing.T) {
+	l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name:           proto.String("bn"),
+		Type:           proto.String("BatchNorm"),
+		BatchNormParam: &pb.BatchNormParameter{UseGlobalStats: proto.Bool(false)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// channel 0 holds 1, 3, 5, 7 and channel 1 holds 10, 10, 20, 20
+	bottom, err := blob.New([]int64{2, 2, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(bottom.Data(), []float64{1, 3, 10, 10, 5, 7, 20, 20})
+
+	top, err := l.Forward([]*blob.Blob{bottom})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	std0 := math.Sqrt(5 + 1e-5)
+	std1 := math.Sqrt(25 + 1e-5)
+	expect := []float64{-3 / std0, -1 / std0, -5 / std1, -5 / std1, 1 / std0, 3 / std0, 5 / std1, 5 / std1}
+	for i, v := range top[0].Data() {
+		if math.Abs(v-expect[i]) > 1e-9 {
+			t.Fatalf("top %v, expect %v", top[0].Data(), expect)
+		}
+	}
+}
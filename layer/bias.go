@@ -0,0 +1,173 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// BiasLayer adds a bias broadcast along the bottom axes from axis, as
+// bias_layer.cpp. The bias is either the second bottom or a learned blob
+// whose shape spans num_axes axes of the bottom
+type BiasLayer struct {
+	axis    int
+	numAxes int
+	filler  *pb.FillerParameter
+	bias    *blob.Blob
+	bottom  []string
+	top     []string
+	name    string
+}
+
+func NewBiasLayer(param *pb.LayerParameter) (*BiasLayer, error) {
+	biasParam := param.GetBiasParam()
+	if biasParam.GetNumAxes() < -1 {
+		return nil, fmt.Errorf("create bias layer %s fail, num_axes must be >= 0, or -1 for all", param.GetName())
+	}
+
+	bias := &BiasLayer{
+		axis:    int(biasParam.GetAxis()),
+		numAxes: int(biasParam.GetNumAxes()),
+		filler:  biasParam.GetFiller(),
+		bottom:  param.GetBottom(),
+		top:     param.GetTop(),
+		name:    param.GetName(),
+	}
+
+	if len(param.GetBottom()) == 1 && len(param.GetBlobs()) > 0 {
+		b, err := blob.FromProto(param.GetBlobs()[0])
+		if err != nil {
+			return nil, err
+		}
+		bias.bias = b
+	}
+
+	return bias, nil
+}
+
+func (bias *BiasLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return bias.ForwardContext(context.Background(), bottom)
+}
+
+func (bias *BiasLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	b := bias.bias
+	if len(bottom) > 1 {
+		b = bottom[1]
+	}
+	if b == nil {
+		return nil, fmt.Errorf("bias layer %s: no bias, copy the trained layers or init the blobs first", bias.name)
+	}
+
+	outer, dim, inner, err := broadcastShape(bottom[0], b, bias.axis)
+	if err != nil {
+		return nil, fmt.Errorf("bias layer %s: %s", bias.name, err)
+	}
+
+	top, err := newTop(ctx, bottom[0].Shape())
+	if err != nil {
+		return nil, err
+	}
+	addBias(top.Data(), bottom[0].Data(), b.Data(), outer, dim, inner)
+
+	logForward(bias.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+// InitBlobs fills the learned bias not loaded from a trained model with the
+// filler, constant 0 by default
+func (bias *BiasLayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	if len(bias.bottom) > 1 {
+		return nil, nil
+	}
+
+	if bias.bias == nil {
+		shape, err := paramShape(bottom[0], bias.axis, bias.numAxes)
+		if err != nil {
+			return nil, fmt.Errorf("bias layer %s: %s", bias.name, err)
+		}
+		b, err := newFilledBlob(shape, bias.filler, rng)
+		if err != nil {
+			return nil, err
+		}
+		bias.bias = b
+	}
+
+	return []*blob.Blob{bias.bias}, nil
+}
+
+func (bias *BiasLayer) Type() string {
+	return bias.name
+}
+
+func (bias *BiasLayer) Bottom() []string {
+	return bias.bottom
+}
+
+func (bias *BiasLayer) Top() []string {
+	return bias.top
+}
+
+// addBias sets dst to src plus the bias of dim values broadcast over the
+// outer and inner counts
+func addBias(dst, src, bias []float64, outer, dim, inner int) {
+	for n := 0; n < outer; n++ {
+		for d := 0; d < dim; d++ {
+			offset := (n*dim + d) * inner
+			for i := offset; i < offset+inner; i++ {
+				dst[i] = src[i] + bias[d]
+			}
+		}
+	}
+}
+
+// paramShape returns the shape of a parameter spanning numAxes axes of the
+// bottom from axis, -1 spanning all remaining axes
+func paramShape(bottom *blob.Blob, axis, numAxes int) ([]int64, error) {
+	axis, err := bottom.CanonicalAxisIndex(axis)
+	if err != nil {
+		return nil, err
+	}
+
+	end := bottom.AxesNum()
+	if numAxes >= 0 {
+		end = axis + numAxes
+	}
+	if end > bottom.AxesNum() {
+		return nil, fmt.Errorf("axis %d + num_axes %d out of range for bottom shape %v", axis, numAxes, bottom.Shape())
+	}
+
+	shape := make([]int64, end-axis)
+	copy(shape, bottom.Shape()[axis:end])
+	return shape, nil
+}
+
+// broadcastShape returns the counts of the bottom before, along and after
+// the parameter broadcast from axis, whose shape must match the bottom axes
+// it spans. A scalar parameter is broadcast over the whole bottom
+func broadcastShape(bottom, param *blob.Blob, axis int) (int, int, int, error) {
+	if param.AxesNum() == 0 {
+		return 1, 1, int(bottom.Capacity()), nil
+	}
+
+	axis, err := bottom.CanonicalAxisIndex(axis)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if axis+param.AxesNum() > bottom.AxesNum() {
+		return 0, 0, 0, fmt.Errorf("parameter shape %v from axis %d out of bottom shape %v", param.Shape(), axis, bottom.Shape())
+	}
+	for i, v := range param.Shape() {
+		if bottom.ShapeOfIndex(axis+i) != v {
+			return 0, 0, 0, fmt.Errorf("parameter shape %v mismatch bottom shape %v from axis %d", param.Shape(), bottom.Shape(), axis)
+		}
+	}
+
+	outer := int(bottom.CountRange(0, axis))
+	dim := int(param.Capacity())
+	inner := int(bottom.CountRange(axis+param.AxesNum(), bottom.AxesNum()))
+	return outer, dim, inner, nil
+}
@@ -0,0 +1,52 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestBiasLayer(t *testing.T) {
+	l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name:   proto.String("bias"),
+		Type:   proto.String("Bias"),
+		Bottom: []string{"data"},
+		Blobs: []*pb.BlobProto{
+			{Shape: &pb.BlobShape{Dim: []int64{2}}, Data: []float32{10, -10}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{2, 2, 1, 1}, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []float64{10, -9, 12, -7}; !equalData(top[0].Data(), expect) {
+		t.Fatalf("top %v, expect %v", top[0].Data(), expect)
+	}
+
+	// a scalar second bottom is added to every value
+	l, err = LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name:   proto.String("bias"),
+		Type:   proto.String("Bias"),
+		Bottom: []string{"data", "bias"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scalar, err := blob.Init([]int64{}, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err = l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 3}, 0), scalar})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []float64{0.5, 1.5, 2.5}; !equalData(top[0].Data(), expect) {
+		t.Fatalf("top %v, expect %v", top[0].Data(), expect)
+	}
+}
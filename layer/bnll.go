@@ -0,0 +1,33 @@
+package layer
+
+import (
+	"context"
+	"math"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// BNLLLayer computes the binomial normal log likelihood y = \log(1 + \exp(x)),
+// written as x + \log(1 + \exp(-x)) for positive x so that it does not
+// overflow
+type BNLLLayer struct {
+	neuron
+}
+
+func NewBNLLLayer(param *pb.LayerParameter) (*BNLLLayer, error) {
+	return &BNLLLayer{neuron: newNeuron(param)}, nil
+}
+
+func (bnll *BNLLLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return bnll.ForwardContext(context.Background(), bottom)
+}
+
+func (bnll *BNLLLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return bnll.forward(ctx, bottom, func(x float64) float64 {
+		if x > 0 {
+			return x + math.Log1p(math.Exp(-x))
+		}
+		return math.Log1p(math.Exp(x))
+	})
+}
@@ -0,0 +1,136 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// ConcatLayer concatenates any number of bottoms along the concat axis, all
+// other dimensions of the bottoms must match
+type ConcatLayer struct {
+	axis      int
+	legacyDim bool
+	bottom    []string
+	top       []string
+	name      string
+}
+
+func NewConcatLayer(param *pb.LayerParameter) (*ConcatLayer, error) {
+	concatParam := param.GetConcatParam()
+	if concatParam == nil {
+		concatParam = &pb.ConcatParameter{}
+	}
+	if concatParam.ConcatDim != nil && concatParam.Axis != nil {
+		return nil, fmt.Errorf("create concat layer %s fail, either axis or concat_dim should be specified", param.GetName())
+	}
+	if len(param.GetBottom()) == 0 {
+		return nil, fmt.Errorf("create concat layer %s fail, no bottom", param.GetName())
+	}
+
+	// the legacy concat_dim cannot count from the last axis
+	axis := int(concatParam.GetAxis())
+	legacyDim := concatParam.ConcatDim != nil
+	if legacyDim {
+		axis = int(concatParam.GetConcatDim())
+	}
+
+	return &ConcatLayer{
+		axis:      axis,
+		legacyDim: legacyDim,
+		bottom:    param.GetBottom(),
+		top:       param.GetTop(),
+		name:      param.GetName(),
+	}, nil
+}
+
+func (concat *ConcatLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return concat.ForwardContext(context.Background(), bottom)
+}
+
+// ForwardContext returns a single bottom as its own concatenation
+func (concat *ConcatLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	shape, axis, err := concat.topShape(bottom)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single bottom is its own concatenation
+	if len(bottom) == 1 {
+		return []*blob.Blob{bottom[0]}, nil
+	}
+
+	top, err := newTop(ctx, shape)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := int(top.CountRange(0, axis))
+	inner := int(top.CountRange(axis+1, top.AxesNum()))
+	topAxis := int(shape[axis])
+	data := top.Data()
+	offset := 0
+	for _, b := range bottom {
+		size := int(b.ShapeOfIndex(axis)) * inner
+		src := b.Data()
+		for n := 0; n < outer; n++ {
+			copy(data[(n*topAxis+offset)*inner:], src[n*size:(n+1)*size])
+		}
+		offset += int(b.ShapeOfIndex(axis))
+	}
+
+	log.Println(concat.Type(), len(bottom), "bottoms ->", top.Shape())
+
+	return []*blob.Blob{top}, nil
+}
+
+// topShape returns the shape of the top and the concat axis, checking that
+// the bottoms only differ on the concat axis
+func (concat *ConcatLayer) topShape(bottom []*blob.Blob) ([]int64, int, error) {
+	if len(bottom) == 0 {
+		return nil, 0, fmt.Errorf("concat layer %s: no bottom", concat.name)
+	}
+
+	axis := concat.axis
+	if concat.legacyDim && axis < 0 {
+		return nil, 0, fmt.Errorf("concat layer %s: concat_dim %d should be >= 0", concat.name, axis)
+	}
+	axis, err := bottom[0].CanonicalAxisIndex(axis)
+	if err != nil {
+		return nil, 0, fmt.Errorf("concat layer %s: %s", concat.name, err)
+	}
+
+	shape := make([]int64, bottom[0].AxesNum())
+	copy(shape, bottom[0].Shape())
+	for i := 1; i < len(bottom); i++ {
+		if bottom[i].AxesNum() != len(shape) {
+			return nil, 0, fmt.Errorf("concat layer %s: bottom %d has %d axes, expect %d", concat.name, i, bottom[i].AxesNum(), len(shape))
+		}
+		for j, v := range bottom[i].Shape() {
+			if j == axis {
+				shape[j] += v
+				continue
+			}
+			if v != shape[j] {
+				return nil, 0, fmt.Errorf("concat layer %s: bottom %d shape %v mismatch bottom 0 shape %v outside concat axis %d", concat.name, i, bottom[i].Shape(), bottom[0].Shape(), axis)
+			}
+		}
+	}
+
+	return shape, axis, nil
+}
+
+func (concat *ConcatLayer) Type() string {
+	return concat.name
+}
+
+func (concat *ConcatLayer) Bottom() []string {
+	return concat.bottom
+}
+
+func (concat *ConcatLayer) Top() []string {
+	return concat.top
+}
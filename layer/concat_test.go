@@ -0,0 +1,123 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// rangeBlob returns a blob of the shape filled with start, start+1, ...
+func rangeBlob(t *testing.T, shape []int64, start float64) *blob.Blob {
+	b, err := blob.New(shape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range b.Data() {
+		b.Data()[i] = start + float64(i)
+	}
+
+	return b
+}
+
+func equalData(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalShape(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestConcatLayer(t *testing.T) {
+	tests := []struct {
+		param  *pb.ConcatParameter
+		shapes [][]int64
+		shape  []int64
+		data   []float64
+	}{
+		{
+			// default channel axis
+			param:  nil,
+			shapes: [][]int64{{2, 1, 1, 2}, {2, 2, 1, 2}, {2, 1, 1, 2}},
+			shape:  []int64{2, 4, 1, 2},
+			data:   []float64{0, 1, 10, 11, 12, 13, 20, 21, 2, 3, 14, 15, 16, 17, 22, 23},
+		},
+		{
+			param:  &pb.ConcatParameter{Axis: proto.Int32(-1)},
+			shapes: [][]int64{{2, 2}, {2, 1}},
+			shape:  []int64{2, 3},
+			data:   []float64{0, 1, 10, 2, 3, 11},
+		},
+		{
+			param:  &pb.ConcatParameter{ConcatDim: proto.Uint32(0)},
+			shapes: [][]int64{{1, 2}, {2, 2}},
+			shape:  []int64{3, 2},
+			data:   []float64{0, 1, 10, 11, 12, 13},
+		},
+	}
+
+	for i, test := range tests {
+		param := &pb.LayerParameter{
+			Name:        proto.String("concat"),
+			Type:        proto.String("Concat"),
+			ConcatParam: test.param,
+		}
+		bottom := []*blob.Blob{}
+		for j, shape := range test.shapes {
+			param.Bottom = append(param.Bottom, "data")
+			bottom = append(bottom, rangeBlob(t, shape, float64(10*j)))
+		}
+
+		l, err := LayerRegister.CreateLayer(param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, err := l.Forward(bottom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Fatalf("test %d: top shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Fatalf("test %d: top %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
+
+func TestConcatLayerShapeMismatch(t *testing.T) {
+	param := &pb.LayerParameter{
+		Name:   proto.String("concat1"),
+		Type:   proto.String("CONCAT"),
+		Bottom: []string{"a", "b"},
+	}
+	l, err := LayerRegister.CreateLayer(param)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bottom := []*blob.Blob{rangeBlob(t, []int64{1, 2, 3, 3}, 0), rangeBlob(t, []int64{1, 2, 3, 2}, 0)}
+	if _, err := l.Forward(bottom); err == nil {
+		t.Fatal("expect error for bottoms mismatching outside the concat axis")
+	}
+}
@@ -1,10 +1,17 @@
 package layer
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"math/rand"
 
 	"github.com/cvley/gocaffe/blob"
+	"github.com/cvley/gocaffe/utils"
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas64"
+
 	pb "github.com/cvley/gocaffe/proto"
 )
 
@@ -15,7 +22,85 @@ type convolutionParam struct {
 	dilation []int
 }
 
-// ConvLayer implement convolution layer struct.
+// newConvolutionParam returns the kernel, pad, stride and dilation of the
+// convolution parameters as [h, w] pairs, from either the repeated fields or
+// the _h and _w fields, as base_conv_layer.cpp
+func newConvolutionParam(convParam *pb.ConvolutionParameter) (*convolutionParam, error) {
+	kernel, err := spatialParam("kernel", convParam.GetKernelSize(), convParam.KernelH, convParam.KernelW, 0)
+	if err != nil {
+		return nil, err
+	}
+	pad, err := spatialParam("pad", convParam.GetPad(), convParam.PadH, convParam.PadW, 0)
+	if err != nil {
+		return nil, err
+	}
+	stride, err := spatialParam("stride", convParam.GetStride(), convParam.StrideH, convParam.StrideW, 1)
+	if err != nil {
+		return nil, err
+	}
+	dilation, err := spatialParam("dilation", convParam.GetDilation(), nil, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < 2; i++ {
+		if kernel[i] <= 0 {
+			return nil, errors.New("kernel size must be specified and > 0")
+		}
+		if stride[i] <= 0 {
+			return nil, errors.New("stride must be > 0")
+		}
+		if dilation[i] <= 0 {
+			return nil, errors.New("dilation must be > 0")
+		}
+	}
+
+	return &convolutionParam{
+		pad:      pad,
+		kernel:   kernel,
+		stride:   stride,
+		dilation: dilation,
+	}, nil
+}
+
+// spatialParam returns the [h, w] pair of a repeated field holding none, one
+// value for both or the two values, or of the h and w fields set instead
+func spatialParam(name string, values []uint32, h, w *uint32, def int) ([]int, error) {
+	if h != nil || w != nil {
+		if h == nil || w == nil {
+			return nil, fmt.Errorf("%s_h and %s_w must both be set", name, name)
+		}
+		if len(values) > 0 {
+			return nil, fmt.Errorf("either %s or %s_h and %s_w should be set", repeatedName(name), name, name)
+		}
+		return []int{int(*h), int(*w)}, nil
+	}
+
+	switch len(values) {
+	case 0:
+		return []int{def, def}, nil
+	case 1:
+		return []int{int(values[0]), int(values[0])}, nil
+	case 2:
+		return []int{int(values[0]), int(values[1])}, nil
+	}
+
+	return nil, fmt.Errorf("%d %s values for 2 spatial axes", len(values), repeatedName(name))
+}
+
+// repeatedName returns the name of the repeated field of the parameter
+func repeatedName(name string) string {
+	if name == "kernel" {
+		return "kernel_size"
+	}
+	return name
+}
+
+// ConvLayer implement convolution layer struct. The bottom axes after axis
+// are the channels and the 2 spatial axes, the axes before axis are all
+// convolved independently. With group, the channels and outputs are split in
+// group parts convolved separately, so the weight is num_output x
+// channels/group x kernel_h x kernel_w
 type ConvLayer struct {
 	bottom []string
 	top    []string
@@ -25,72 +110,37 @@ type ConvLayer struct {
 	param *convolutionParam
 
 	numOutput int64
+	group     int
+	biasTerm  bool
+	axis      int
 	weight    *blob.Blob
 	bias      *blob.Blob
 	name      string
+
+	// fused ReLU applied to the top, set by FuseReLU
+	fuseReLU      bool
+	negativeSlope float64
 }
 
 // NewConvolutionLayer implements the convolution layer construction from
 // parameters.
-func NewConvolutionLayer(param *pb.V1LayerParameter) (*ConvLayer, error) {
+func NewConvolutionLayer(param *pb.LayerParameter) (*ConvLayer, error) {
 	convParam := param.GetConvolutionParam()
 	if convParam == nil {
 		return nil, errors.New("no convolution parameters")
 	}
 
 	name := param.GetName()
-
-	//TODO: compatibility
-	blobprotos := param.GetBlobs()
-	var weight, bias *blob.Blob
-	if blobprotos != nil {
-		var err error
-		weight, err = blob.FromProto(blobprotos[0])
-		if err != nil {
-			return nil, err
-		}
-		if convParam.GetBiasTerm() {
-			bias, err = blob.FromProto(blobprotos[1])
-			if err != nil {
-				return nil, err
-			}
-		}
-		log.Printf("length of weight: %d", weight.Capacity())
+	if convParam.GetNumOutput() == 0 {
+		return nil, fmt.Errorf("create convolution layer %s fail, num_output must be > 0", name)
 	}
-
-	cParam := &convolutionParam{
-		pad:      []int{},
-		kernel:   []int{},
-		stride:   []int{},
-		dilation: []int{},
+	if convParam.GetGroup() == 0 || convParam.GetNumOutput()%convParam.GetGroup() != 0 {
+		return nil, fmt.Errorf("create convolution layer %s fail, num_output %d not divisible by group %d", name, convParam.GetNumOutput(), convParam.GetGroup())
 	}
 
-	for _, v := range convParam.GetPad() {
-		cParam.pad = append(cParam.pad, int(v))
-	}
-	if len(cParam.pad) == 0 {
-		cParam.pad = []int{0}
-	}
-
-	for _, v := range convParam.GetKernelSize() {
-		cParam.kernel = append(cParam.kernel, int(v))
-	}
-	if len(cParam.kernel) == 0 {
-		cParam.kernel = []int{0}
-	}
-
-	for _, v := range convParam.GetStride() {
-		cParam.stride = append(cParam.stride, int(v))
-	}
-	if len(cParam.stride) == 0 {
-		cParam.stride = []int{1}
-	}
-
-	for _, v := range convParam.GetDilation() {
-		cParam.dilation = append(cParam.dilation, int(v))
-	}
-	if len(cParam.dilation) == 0 {
-		cParam.dilation = []int{1}
+	cParam, err := newConvolutionParam(convParam)
+	if err != nil {
+		return nil, fmt.Errorf("create convolution layer %s fail, %s", name, err)
 	}
 
 	convLayer := &ConvLayer{
@@ -98,20 +148,51 @@ func NewConvolutionLayer(param *pb.V1LayerParameter) (*ConvLayer, error) {
 		top:       param.GetTop(),
 		ConvParam: convParam,
 		numOutput: int64(convParam.GetNumOutput()),
+		group:     int(convParam.GetGroup()),
+		biasTerm:  convParam.GetBiasTerm(),
+		axis:      int(convParam.GetAxis()),
 		param:     cParam,
-		weight:    weight,
-		bias:      bias,
 		name:      name,
 	}
 
+	blobprotos := param.GetBlobs()
+	if len(blobprotos) > 0 {
+		weight, err := blob.FromProto(blobprotos[0])
+		if err != nil {
+			return nil, err
+		}
+		convLayer.weight = weight
+	}
+	if convLayer.biasTerm && len(blobprotos) > 1 {
+		bias, err := blob.FromProto(blobprotos[1])
+		if err != nil {
+			return nil, err
+		}
+		if bias.Capacity() != convLayer.numOutput {
+			return nil, fmt.Errorf("create convolution layer %s fail, bias shape %v for num_output %d", name, bias.Shape(), convLayer.numOutput)
+		}
+		convLayer.bias = bias
+	}
+
 	return convLayer, nil
 }
 
 // Forward implement the calculation from bottom to top
 func (conv *ConvLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return conv.ForwardContext(context.Background(), bottom)
+}
+
+// ForwardContext is Forward that stops with ctx.Err() once ctx is done, the
+// context is checked before the im2col of every image and before the gemm of
+// every group
+func (conv *ConvLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	if conv.weight == nil || (conv.biasTerm && conv.bias == nil) {
+		return nil, fmt.Errorf("convolution layer %s: no learned parameters, copy the trained layers or init the blobs first", conv.name)
+	}
+
 	top := []*blob.Blob{}
 	for _, v := range bottom {
-		data, err := conv.forward(v)
+		data, err := conv.forward(ctx, v)
 		if err != nil {
 			return nil, err
 		}
@@ -121,6 +202,51 @@ func (conv *ConvLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 	return top, nil
 }
 
+// InitBlobs fills the weight and bias not loaded from a trained model with the
+// weight_filler and bias_filler of the convolution parameters
+func (conv *ConvLayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	if conv.weight == nil {
+		axis, err := bottom[0].CanonicalAxisIndex(conv.axis)
+		if err != nil {
+			return nil, fmt.Errorf("convolution layer %s: %s", conv.name, err)
+		}
+		shape := []int64{
+			conv.numOutput,
+			bottom[0].ShapeOfIndex(axis) / int64(conv.group),
+			int64(conv.param.kernel[0]),
+			int64(conv.param.kernel[1]),
+		}
+		filler := conv.ConvParam.GetWeightFiller()
+		if filler == nil {
+			filler = defaultWeightFiller
+		}
+		weight, err := newFilledBlob(shape, filler, rng)
+		if err != nil {
+			return nil, err
+		}
+		conv.weight = weight
+	}
+
+	if conv.bias == nil && conv.biasTerm {
+		bias, err := newFilledBlob([]int64{conv.numOutput}, conv.ConvParam.GetBiasFiller(), rng)
+		if err != nil {
+			return nil, err
+		}
+		conv.bias = bias
+	}
+
+	if conv.bias == nil {
+		return []*blob.Blob{conv.weight}, nil
+	}
+	return []*blob.Blob{conv.weight, conv.bias}, nil
+}
+
+// FuseReLU makes Forward apply a ReLU with the negative slope to the top
+func (conv *ConvLayer) FuseReLU(negativeSlope float64) {
+	conv.fuseReLU = true
+	conv.negativeSlope = negativeSlope
+}
+
 // Type of Layer
 func (conv *ConvLayer) Type() string {
 	return conv.name
@@ -134,77 +260,155 @@ func (conv *ConvLayer) Top() []string {
 	return conv.top
 }
 
-func (conv *ConvLayer) forward(bottom *blob.Blob) (*blob.Blob, error) {
-	log.Println("conv", conv.weight.String(), conv.bias.String())
+// convShape holds the sizes of a convolution of one bottom
+type convShape struct {
+	num      int
+	channels int
+	height   int
+	width    int
+	outH     int
+	outW     int
+	// channels and outputs of every group
+	groupIn  int
+	groupOut int
+}
 
-	// convolution
-	convBlob, err := conv.conv(bottom)
+// shape checks the bottom and the weight, and returns the sizes of the
+// convolution with the top shape
+func (conv *ConvLayer) shape(bottom *blob.Blob) (*convShape, []int64, error) {
+	axis, err := bottom.CanonicalAxisIndex(conv.axis)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if bottom.AxesNum() != axis+3 {
+		return nil, nil, fmt.Errorf("bottom shape %v, expect channels and 2 spatial axes from axis %d", bottom.Shape(), axis)
 	}
 
-	log.Println(conv.Type(), bottom.Shape(), "->", convBlob.Shape())
+	s := &convShape{
+		num:      int(bottom.CountRange(0, axis)),
+		channels: int(bottom.ShapeOfIndex(axis)),
+		height:   int(bottom.ShapeOfIndex(axis + 1)),
+		width:    int(bottom.ShapeOfIndex(axis + 2)),
+		groupOut: int(conv.numOutput) / conv.group,
+	}
+	if s.channels%conv.group != 0 {
+		return nil, nil, fmt.Errorf("%d channels not divisible by group %d", s.channels, conv.group)
+	}
+	s.groupIn = s.channels / conv.group
 
-	return convBlob, nil
-}
+	p := conv.param
+	if int(conv.weight.Capacity()) != int(conv.numOutput)*s.groupIn*p.kernel[0]*p.kernel[1] {
+		return nil, nil, fmt.Errorf("weight shape %v, expect %v", conv.weight.Shape(),
+			[]int{int(conv.numOutput), s.groupIn, p.kernel[0], p.kernel[1]})
+	}
 
-func (conv *ConvLayer) conv(data *blob.Blob) (*blob.Blob, error) {
-	num := data.Num()
-	channels := data.Channels()
-	width := data.Width()
-	height := data.Height()
+	s.outH = p.getOutputH(s.height)
+	s.outW = p.getOutputW(s.width)
+	if s.outH <= 0 || s.outW <= 0 {
+		return nil, nil, fmt.Errorf("output size %dx%d for bottom shape %v", s.outH, s.outW, bottom.Shape())
+	}
 
-	outH := conv.param.getOutputH(height)
-	outW := conv.param.getOutputW(width)
+	shape := make([]int64, axis, axis+3)
+	copy(shape, bottom.Shape()[:axis])
+	shape = append(shape, conv.numOutput, int64(s.outH), int64(s.outW))
+	return s, shape, nil
+}
 
-	shape := []int64{data.Num(), conv.numOutput, outH, outW}
-	result, err := blob.New(shape)
+func (conv *ConvLayer) forward(ctx context.Context, bottom *blob.Blob) (*blob.Blob, error) {
+	s, shape, err := conv.shape(bottom)
+	if err != nil {
+		return nil, fmt.Errorf("convolution layer %s: %s", conv.name, err)
+	}
+	result, err := blob.NewContext(ctx, shape)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: simple and naive
-	for n := 0; n < int(num); n++ {
-		for o := 0; o < int(conv.numOutput); o++ {
-			for h := 0; h < int(outH); h++ {
-				for w := 0; w < int(outW); w++ {
-					sH, eH := conv.param.rangeH(h)
-					sW, eW := conv.param.rangeW(w)
-					var sum float64
-					for y := sH; y <= eH; y++ {
-						for x := sW; x <= eW; x++ {
-							if y < 0 || x < 0 || y >= int(height) || x >= int(width) {
-								continue
-							}
-							for c := 0; c < int(channels); c++ {
-								sum += data.Get([]int{n, c, y, x}) * conv.weight.Get([]int{o, c, y, x})
-							}
-						}
-					}
-					result.Set([]int{n, o, h, w}, sum+conv.bias.Get([]int{0, 0, 0, o}))
-				}
-			}
-		}
+	if err := conv.conv(ctx, s, bottom.Data(), result.Data()); err != nil {
+		return nil, err
 	}
 
+	log.Println(conv.Type(), bottom.Shape(), "->", result.Shape())
+
 	return result, nil
 }
 
-func (c *convolutionParam) getOutputH(h int64) int64 {
-	return (h+int64(c.pad[0])*2-(int64(c.dilation[0])*(int64(c.kernel[0])-1)+1))/int64(c.stride[0]) + 1
+// conv computes the convolution of every image as Caffe does: the windows
+// of the image are laid out as columns by im2col, and the weight of every
+// group multiplies the rows of the group channels
+func (conv *ConvLayer) conv(ctx context.Context, s *convShape, src, dst []float64) error {
+	p := conv.param
+	numOutput := int(conv.numOutput)
+	imageSize := s.channels * s.height * s.width
+	outSize := s.outH * s.outW
+	// rows of the weight and of the columns for every group
+	k := s.groupIn * p.kernel[0] * p.kernel[1]
+	weight := conv.weight.Data()
+	// the columns of one image, reused for every image
+	buf, err := blob.NewContext(ctx, []int64{int64(s.channels * p.kernel[0] * p.kernel[1]), int64(outSize)})
+	if err != nil {
+		return err
+	}
+	defer blob.ReleaseContext(ctx, buf)
+	for n := 0; n < s.num; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		col, err := utils.Im2colTo(buf.Data(), src[n*imageSize:(n+1)*imageSize], s.channels, s.height, s.width,
+			p.kernel[0], p.kernel[1], p.pad[0], p.pad[1], p.stride[0], p.stride[1], p.dilation[0], p.dilation[1])
+		if err != nil {
+			return fmt.Errorf("convolution layer %s: %s", conv.name, err)
+		}
+
+		for g := 0; g < conv.group; g++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			a := blas64.General{
+				Rows:   s.groupOut,
+				Cols:   k,
+				Stride: k,
+				Data:   weight[g*s.groupOut*k : (g+1)*s.groupOut*k],
+			}
+			b := blas64.General{
+				Rows:   k,
+				Cols:   outSize,
+				Stride: outSize,
+				Data:   col.Data[g*k*outSize : (g+1)*k*outSize],
+			}
+			offset := (n*numOutput + g*s.groupOut) * outSize
+			c := blas64.General{
+				Rows:   s.groupOut,
+				Cols:   outSize,
+				Stride: outSize,
+				Data:   dst[offset : offset+s.groupOut*outSize],
+			}
+			blas64.Gemm(blas.NoTrans, blas.NoTrans, 1, a, b, 0, c)
+		}
+	}
+
+	conv.addBias(s, dst)
+	return nil
 }
 
-func (c *convolutionParam) getOutputW(w int64) int64 {
-	// TODO
-	return (w+int64(c.pad[0])*2-(int64(c.dilation[0])*(int64(c.kernel[0])-1)+1))/int64(c.stride[0]) + 1
+// addBias adds the bias and applies the fused ReLU to the top
+func (conv *ConvLayer) addBias(s *convShape, dst []float64) {
+	if conv.biasTerm {
+		addBias(dst, dst, conv.bias.Data(), s.num, int(conv.numOutput), s.outH*s.outW)
+	}
+	if conv.fuseReLU {
+		for i, v := range dst {
+			if v < 0 {
+				dst[i] = v * conv.negativeSlope
+			}
+		}
+	}
 }
 
-func (c *convolutionParam) rangeH(h int) (int, int) {
-	r := (c.dilation[0]*(c.kernel[0]-1) + 1) / 2
-	return h - r, h + r
+func (c *convolutionParam) getOutputH(h int) int {
+	return utils.OutputSize(h, c.kernel[0], c.pad[0], c.stride[0], c.dilation[0])
 }
 
-func (c *convolutionParam) rangeW(w int) (int, int) {
-	r := (c.dilation[0]*(c.kernel[0]-1) + 1) / 2
-	return w - r, w + r
+func (c *convolutionParam) getOutputW(w int) int {
+	return utils.OutputSize(w, c.kernel[1], c.pad[1], c.stride[1], c.dilation[1])
 }
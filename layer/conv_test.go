@@ -0,0 +1,349 @@
+package layer
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// patternData returns n values cycling through -off to 10-off with step m
+func patternData(n, m, off int) []float64 {
+	data := make([]float64, n)
+	for i := range data {
+		data[i] = float64(i*m%11 - off)
+	}
+	return data
+}
+
+// patternProto returns the blob proto of the shape with the pattern values
+func patternProto(shape []int64, m, off int) *pb.BlobProto {
+	count := int64(1)
+	for _, v := range shape {
+		count *= v
+	}
+	data := []float32{}
+	for _, v := range patternData(int(count), m, off) {
+		data = append(data, float32(v))
+	}
+	return &pb.BlobProto{Shape: &pb.BlobShape{Dim: shape}, Data: data}
+}
+
+func TestConvLayer(t *testing.T) {
+	// expected outputs computed as Caffe's im2col and gemm for every group
+	tests := []struct {
+		param  *pb.ConvolutionParameter
+		bottom []int64
+		input  []float64
+		blobs  []*pb.BlobProto
+		shape  []int64
+		data   []float64
+	}{
+		{
+			// grouped as AlexNet conv2, with stride and pad
+			&pb.ConvolutionParameter{
+				NumOutput: proto.Uint32(4), Group: proto.Uint32(2),
+				KernelSize: []uint32{3}, Stride: []uint32{2}, Pad: []uint32{1},
+			},
+			[]int64{1, 4, 5, 5},
+			patternData(100, 7, 3),
+			[]*pb.BlobProto{
+				patternProto([]int64{4, 2, 3, 3}, 5, 5),
+				{Shape: &pb.BlobShape{Dim: []int64{4}}, Data: []float32{1, -1, 0.5, 2}},
+			},
+			[]int64{1, 4, 3, 3},
+			[]float64{
+				47, -11, -25, -14, -40, 107, 46, 35, -25, 39, -1, -5,
+				-63, -15, -21, -20, 13, -8, -41.5, -41.5, -10.5, 34.5, -6.5, -3.5,
+				-17.5, 3.5, 80.5, 10, 1, 3, 40, 27, 44, -13, -8, -52,
+			},
+		},
+		{
+			// asymmetric kernel, stride and pad without bias
+			&pb.ConvolutionParameter{
+				NumOutput: proto.Uint32(3), BiasTerm: proto.Bool(false),
+				KernelH: proto.Uint32(2), KernelW: proto.Uint32(3),
+				StrideH: proto.Uint32(1), StrideW: proto.Uint32(2),
+				PadH: proto.Uint32(1), PadW: proto.Uint32(0),
+			},
+			[]int64{2, 2, 4, 5},
+			patternData(80, 3, 4),
+			[]*pb.BlobProto{patternProto([]int64{3, 2, 2, 3}, 4, 2)},
+			[]int64{2, 3, 5, 2},
+			[]float64{
+				44, -21, 43, -2, 2, 78, 71, 4, 20, 18, -30, 27,
+				68, 25, -12, 66, -26, 30, 36, 35, -38, 20, -17, 63,
+				106, 65, 9, 67, -3, -3, -2, -23, 78, -33, 4, 102,
+				62, 17, 2, 0, 10, 67, 66, 34, 30, 9, 5, 83,
+				16, 15, 88, -19, 65, 112, 67, 48, -41, 39, -25, -25,
+			},
+		},
+		{
+			// depthwise with dilation
+			&pb.ConvolutionParameter{
+				NumOutput: proto.Uint32(3), Group: proto.Uint32(3),
+				KernelSize: []uint32{3}, Dilation: []uint32{2}, Pad: []uint32{2},
+			},
+			[]int64{1, 3, 4, 4},
+			patternData(48, 5, 6),
+			[]*pb.BlobProto{
+				patternProto([]int64{3, 1, 3, 3}, 3, 1),
+				{Shape: &pb.BlobShape{Dim: []int64{3}}, Data: []float32{0.5, 0, -0.5}},
+			},
+			[]int64{1, 3, 4, 4},
+			[]float64{
+				21.5, -56.5, -41.5, -91.5, -4.5, 27.5, 0.5, 27.5, 8.5, -29.5, 22.5, -42.5,
+				10.5, -16.5, -6.5, 27.5, -17, -6, -17, 0, -61, -50, -37, -20,
+				27, -21, -17, -4, -11, -59, -53, -40, -34.5, 21.5, -59.5, -41.5,
+				-52.5, -7.5, -9.5, -2.5, -10.5, 8.5, -24.5, -43.5, -0.5, 7.5, -67.5, 23.5,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:             proto.String("conv"),
+			Type:             proto.String("Convolution"),
+			ConvolutionParam: test.param,
+			Blobs:            test.blobs,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bottom, err := blob.New(test.bottom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(bottom.Data(), test.input)
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Errorf("test %d: shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Errorf("test %d: data %v, expect %v", i, top[0].Data(), test.data)
+		}
+
+		// the axes before the channel axis are all convolved as images
+		shape := append([]int64{1}, test.bottom...)
+		test.param.Axis = proto.Int32(2)
+		l, err = LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:             proto.String("conv"),
+			Type:             proto.String("Convolution"),
+			ConvolutionParam: test.param,
+			Blobs:            test.blobs,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bottom, err = bottom.Reshape(shape)
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, err = l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := append([]int64{1}, test.shape...); !equalShape(top[0].Shape(), expect) {
+			t.Errorf("test %d axis 2: shape %v, expect %v", i, top[0].Shape(), expect)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Errorf("test %d axis 2: data %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
+
+func TestConvLayerInvalid(t *testing.T) {
+	for _, param := range []*pb.ConvolutionParameter{
+		nil,
+		{KernelSize: []uint32{3}},
+		{NumOutput: proto.Uint32(3), Group: proto.Uint32(2), KernelSize: []uint32{3}},
+		{NumOutput: proto.Uint32(2)},
+		{NumOutput: proto.Uint32(2), KernelSize: []uint32{3}, StrideH: proto.Uint32(2)},
+	} {
+		if _, err := NewConvolutionLayer(&pb.LayerParameter{Name: proto.String("conv"), ConvolutionParam: param}); err == nil {
+			t.Errorf("expect error for convolution param %v", param)
+		}
+	}
+
+	// 3 channels can not be split in 2 groups
+	l, err := NewConvolutionLayer(&pb.LayerParameter{
+		Name:             proto.String("conv"),
+		ConvolutionParam: &pb.ConvolutionParameter{NumOutput: proto.Uint32(2), Group: proto.Uint32(2), KernelSize: []uint32{1}, BiasTerm: proto.Bool(false)},
+		Blobs:            []*pb.BlobProto{patternProto([]int64{2, 1, 1, 1}, 1, 0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 3, 2, 2}, 0)}); err == nil {
+		t.Error("expect error for channels not divisible by group")
+	}
+}
+
+// directConv is the convolution of the layer summed window by window, the
+// reference for the im2col and gemm convolution
+func directConv(t testing.TB, conv *ConvLayer, bottom *blob.Blob) []float64 {
+	s, _, err := conv.shape(bottom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := conv.param
+	src := bottom.Data()
+	weight := conv.weight.Data()
+	numOutput := int(conv.numOutput)
+	kernelSize := p.kernel[0] * p.kernel[1]
+	dst := make([]float64, s.num*numOutput*s.outH*s.outW)
+	for n := 0; n < s.num; n++ {
+		for o := 0; o < numOutput; o++ {
+			g := o / s.groupOut
+			out := dst[(n*numOutput+o)*s.outH*s.outW:]
+			for oy := 0; oy < s.outH; oy++ {
+				for ox := 0; ox < s.outW; ox++ {
+					var sum float64
+					for ci := 0; ci < s.groupIn; ci++ {
+						in := src[(n*s.channels+g*s.groupIn+ci)*s.height*s.width:]
+						w := weight[(o*s.groupIn+ci)*kernelSize:]
+						for ky := 0; ky < p.kernel[0]; ky++ {
+							y := oy*p.stride[0] - p.pad[0] + ky*p.dilation[0]
+							if y < 0 || y >= s.height {
+								continue
+							}
+							for kx := 0; kx < p.kernel[1]; kx++ {
+								x := ox*p.stride[1] - p.pad[1] + kx*p.dilation[1]
+								if x < 0 || x >= s.width {
+									continue
+								}
+								sum += in[y*s.width+x] * w[ky*p.kernel[1]+kx]
+							}
+						}
+					}
+					out[oy*s.outW+ox] = sum
+				}
+			}
+		}
+	}
+
+	conv.addBias(s, dst)
+	return dst
+}
+
+// newAlexNetConv1 returns the AlexNet conv1 layer with filled blobs and its
+// 227 x 227 bottom
+func newAlexNetConv1(t testing.TB) (*ConvLayer, *blob.Blob) {
+	conv, err := NewConvolutionLayer(&pb.LayerParameter{
+		Name: proto.String("conv1"),
+		ConvolutionParam: &pb.ConvolutionParameter{
+			NumOutput:    proto.Uint32(96),
+			KernelSize:   []uint32{11},
+			Stride:       []uint32{4},
+			WeightFiller: &pb.FillerParameter{Type: proto.String("gaussian"), Std: proto.Float32(0.01)},
+			BiasFiller:   &pb.FillerParameter{Type: proto.String("constant"), Value: proto.Float32(0.1)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bottom, err := blob.New([]int64{1, 3, 227, 227})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := range bottom.Data() {
+		bottom.Data()[i] = rng.Float64()*255 - 128
+	}
+	if _, err := conv.InitBlobs([]*blob.Blob{bottom}, rng); err != nil {
+		t.Fatal(err)
+	}
+
+	return conv, bottom
+}
+
+func TestConvLayerGemmMatchesDirect(t *testing.T) {
+	conv, bottom := newAlexNetConv1(t)
+	if expect := []int64{96}; !equalShape(conv.bias.Shape(), expect) {
+		t.Fatalf("bias shape %v, expect %v", conv.bias.Shape(), expect)
+	}
+	top, err := conv.Forward([]*blob.Blob{bottom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []int64{1, 96, 55, 55}; !equalShape(top[0].Shape(), expect) {
+		t.Fatalf("shape %v, expect %v", top[0].Shape(), expect)
+	}
+
+	expect := directConv(t, conv, bottom)
+	for i, v := range top[0].Data() {
+		if math.Abs(v-expect[i]) > 1e-9*math.Max(1, math.Abs(expect[i])) {
+			t.Fatalf("value %d is %v, expect %v", i, v, expect[i])
+		}
+	}
+}
+
+// legacyConv is the loop replaced by im2col and gemm, a Get of the bottom and
+// of the weight for every multiply, only the window placement follows the
+// stride and the weight is indexed by the kernel position so it runs on the
+// AlexNet conv1, it ignores groups and is kept for the benchmark
+func legacyConv(conv *ConvLayer, s *convShape, data *blob.Blob, result *blob.Blob) {
+	p := conv.param
+	for n := 0; n < s.num; n++ {
+		for o := 0; o < int(conv.numOutput); o++ {
+			for h := 0; h < s.outH; h++ {
+				for w := 0; w < s.outW; w++ {
+					sH := h*p.stride[0] - p.pad[0]
+					sW := w*p.stride[1] - p.pad[1]
+					var sum float64
+					for ky := 0; ky < p.kernel[0]; ky++ {
+						for kx := 0; kx < p.kernel[1]; kx++ {
+							y := sH + ky*p.dilation[0]
+							x := sW + kx*p.dilation[1]
+							if y < 0 || x < 0 || y >= s.height || x >= s.width {
+								continue
+							}
+							for c := 0; c < s.channels; c++ {
+								sum += data.Get([]int{n, c, y, x}) * conv.weight.Get([]int{o, c, ky, kx})
+							}
+						}
+					}
+					sum += conv.bias.Get([]int{o})
+					result.Set([]int{n, o, h, w}, sum)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkAlexNetConv1 times the convolution without the logging of Forward
+func BenchmarkAlexNetConv1(b *testing.B) {
+	conv, bottom := newAlexNetConv1(b)
+	s, shape, err := conv.shape(bottom)
+	if err != nil {
+		b.Fatal(err)
+	}
+	top, err := blob.New(shape)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("im2col_gemm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := conv.conv(context.Background(), s, bottom.Data(), top.Data()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("legacy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			legacyConv(conv, s, bottom, top)
+		}
+	})
+}
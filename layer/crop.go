@@ -0,0 +1,148 @@
+package layer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// CropLayer crops the first bottom to the shape of the second bottom on the
+// axes from axis onwards, starting at the offsets, as crop_layer.cpp. A
+// single offset is used for all cropped axes
+type CropLayer struct {
+	axis    int
+	offsets []int64
+	bottom  []string
+	top     []string
+	name    string
+}
+
+func NewCropLayer(param *pb.LayerParameter) (*CropLayer, error) {
+	if len(param.GetBottom()) != 2 {
+		return nil, fmt.Errorf("create crop layer %s fail, %d bottoms, expect the blob to crop and the reference", param.GetName(), len(param.GetBottom()))
+	}
+
+	cropParam := param.GetCropParam()
+	if cropParam == nil {
+		cropParam = &pb.CropParameter{}
+	}
+	offsets := make([]int64, len(cropParam.GetOffset()))
+	for i, v := range cropParam.GetOffset() {
+		offsets[i] = int64(v)
+	}
+
+	return &CropLayer{
+		axis:    int(cropParam.GetAxis()),
+		offsets: offsets,
+		bottom:  param.GetBottom(),
+		top:     param.GetTop(),
+		name:    param.GetName(),
+	}, nil
+}
+
+func (crop *CropLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return crop.ForwardContext(context.Background(), bottom)
+}
+
+func (crop *CropLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	if len(bottom) != 2 {
+		return nil, errors.New("crop layer needs 2 bottoms")
+	}
+
+	offsets, shape, err := crop.cropShape(bottom[0], bottom[1])
+	if err != nil {
+		return nil, err
+	}
+
+	top, err := newTop(ctx, shape)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy the rows of the last axis one by one, idx is the index in the top
+	// of the row being copied
+	axes := len(shape)
+	src := bottom[0].Data()
+	data := top.Data()
+	width := int(shape[axes-1])
+	idx := make([]int64, axes)
+	for row := 0; width > 0 && row < len(data)/width; row++ {
+		start := int64(0)
+		for i := 0; i < axes; i++ {
+			start = start*bottom[0].ShapeOfIndex(i) + idx[i] + offsets[i]
+		}
+		copy(data[row*width:(row+1)*width], src[start:start+int64(width)])
+
+		for i := axes - 2; i >= 0; i-- {
+			idx[i]++
+			if idx[i] < shape[i] {
+				break
+			}
+			idx[i] = 0
+		}
+	}
+
+	logForward(crop.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+// cropShape returns the offset on every axis of the blob to crop, and the
+// shape of the top
+func (crop *CropLayer) cropShape(b, reference *blob.Blob) ([]int64, []int64, error) {
+	if b.AxesNum() != reference.AxesNum() {
+		return nil, nil, fmt.Errorf("crop layer %s: bottom shape %v and reference shape %v have different number of axes", crop.name, b.Shape(), reference.Shape())
+	}
+	if b.AxesNum() == 0 {
+		return nil, nil, fmt.Errorf("crop layer %s: cannot crop a scalar", crop.name)
+	}
+
+	axis, err := b.CanonicalAxisIndex(crop.axis)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crop layer %s: %s", crop.name, err)
+	}
+
+	// either one offset for all cropped axes, or one offset per axis
+	if len(crop.offsets) > 1 && len(crop.offsets) != b.AxesNum()-axis {
+		return nil, nil, fmt.Errorf("crop layer %s: %d offsets for %d cropped axes from axis %d", crop.name, len(crop.offsets), b.AxesNum()-axis, axis)
+	}
+
+	offsets := make([]int64, b.AxesNum())
+	shape := make([]int64, b.AxesNum())
+	for i := range shape {
+		if i < axis {
+			shape[i] = b.ShapeOfIndex(i)
+			continue
+		}
+
+		switch len(crop.offsets) {
+		case 0:
+		case 1:
+			offsets[i] = crop.offsets[0]
+		default:
+			offsets[i] = crop.offsets[i-axis]
+		}
+
+		shape[i] = reference.ShapeOfIndex(i)
+		if b.ShapeOfIndex(i)-offsets[i] < shape[i] {
+			return nil, nil, fmt.Errorf("crop layer %s: offset %d on axis %d crops bottom shape %v out of bounds for reference shape %v", crop.name, offsets[i], i, b.Shape(), reference.Shape())
+		}
+	}
+
+	return offsets, shape, nil
+}
+
+func (crop *CropLayer) Type() string {
+	return crop.name
+}
+
+func (crop *CropLayer) Bottom() []string {
+	return crop.bottom
+}
+
+func (crop *CropLayer) Top() []string {
+	return crop.top
+}
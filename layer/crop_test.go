@@ -0,0 +1,99 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestCropLayer(t *testing.T) {
+	tests := []struct {
+		param *pb.CropParameter
+		ref   []int64
+		data  []float64
+	}{
+		{
+			// default axis 2 without offset
+			param: nil,
+			ref:   []int64{1, 1, 2, 2},
+			data:  []float64{0, 1, 4, 5, 16, 17, 20, 21},
+		},
+		{
+			// broadcast offset
+			param: &pb.CropParameter{Offset: []uint32{1}},
+			ref:   []int64{1, 1, 2, 2},
+			data:  []float64{5, 6, 9, 10, 21, 22, 25, 26},
+		},
+		{
+			// offset per axis from axis 1
+			param: &pb.CropParameter{Axis: proto.Int32(1), Offset: []uint32{1, 2, 0}},
+			ref:   []int64{1, 1, 1, 3},
+			data:  []float64{24, 25, 26},
+		},
+	}
+
+	bottom := rangeBlob(t, []int64{1, 2, 4, 4}, 0)
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:      proto.String("crop"),
+			Type:      proto.String("Crop"),
+			Bottom:    []string{"data", "ref"},
+			CropParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := rangeBlob(t, test.ref, 0)
+		top, err := l.Forward([]*blob.Blob{bottom, ref})
+		if err != nil {
+			t.Fatalf("test %d: %s", i, err)
+		}
+
+		// the axes before the crop axis are kept
+		shape := append([]int64{}, test.ref...)
+		axis := int(test.param.GetAxis())
+		if test.param == nil {
+			axis = 2
+		}
+		copy(shape, bottom.Shape()[:axis])
+		if !equalShape(top[0].Shape(), shape) {
+			t.Fatalf("test %d: top shape %v, expect %v", i, top[0].Shape(), shape)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Fatalf("test %d: top %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
+
+func TestCropLayerOutOfBounds(t *testing.T) {
+	l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name:      proto.String("crop"),
+		Type:      proto.String("Crop"),
+		Bottom:    []string{"data", "ref"},
+		CropParam: &pb.CropParameter{Offset: []uint32{3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bottom := rangeBlob(t, []int64{1, 2, 4, 4}, 0)
+	ref := rangeBlob(t, []int64{1, 2, 2, 2}, 0)
+	if _, err := l.Forward([]*blob.Blob{bottom, ref}); err == nil {
+		t.Fatal("expect error for offset 3 cropping 2 values of 4")
+	}
+
+	l, err = NewCropLayer(&pb.LayerParameter{
+		Name:      proto.String("crop"),
+		Bottom:    []string{"data", "ref"},
+		CropParam: &pb.CropParameter{Offset: []uint32{1, 1, 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Forward([]*blob.Blob{bottom, ref}); err == nil {
+		t.Fatal("expect error for 3 offsets on 2 cropped axes")
+	}
+}
@@ -11,7 +11,7 @@ import (
 type DataLayer struct {
 }
 
-func NewDataLayer(param *pb.V1LayerParameter) (*DataLayer, error) {
+func NewDataLayer(param *pb.LayerParameter) (*DataLayer, error) {
 	dataParam := param.GetDataParam()
 	log.Println(dataParam)
 	if dataParam == nil {
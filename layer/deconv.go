@@ -0,0 +1,231 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// DeconvLayer implements the deconvolution, or transposed convolution, of
+// deconv_layer.cpp. It takes the convolution parameters, but every bottom
+// value is scattered through the kernel to the top, so the top is stride
+// times larger than the bottom. The weight has Caffe's deconvolution layout
+// channels x num_output/group x kernel_h x kernel_w
+type DeconvLayer struct {
+	numOutput int
+	group     int
+	biasTerm  bool
+	convParam *pb.ConvolutionParameter
+	param     *convolutionParam
+	weight    *blob.Blob
+	bias      *blob.Blob
+	bottom    []string
+	top       []string
+	name      string
+}
+
+func NewDeconvolutionLayer(param *pb.LayerParameter) (*DeconvLayer, error) {
+	convParam := param.GetConvolutionParam()
+	if convParam == nil {
+		return nil, fmt.Errorf("create deconvolution layer %s fail, no convolution parameters", param.GetName())
+	}
+	if convParam.GetNumOutput() == 0 {
+		return nil, fmt.Errorf("create deconvolution layer %s fail, num_output must be > 0", param.GetName())
+	}
+	if convParam.GetGroup() == 0 || convParam.GetNumOutput()%convParam.GetGroup() != 0 {
+		return nil, fmt.Errorf("create deconvolution layer %s fail, num_output %d not divisible by group %d", param.GetName(), convParam.GetNumOutput(), convParam.GetGroup())
+	}
+
+	cParam, err := newConvolutionParam(convParam)
+	if err != nil {
+		return nil, fmt.Errorf("create deconvolution layer %s fail, %s", param.GetName(), err)
+	}
+
+	deconv := &DeconvLayer{
+		numOutput: int(convParam.GetNumOutput()),
+		group:     int(convParam.GetGroup()),
+		biasTerm:  convParam.GetBiasTerm(),
+		convParam: convParam,
+		param:     cParam,
+		bottom:    param.GetBottom(),
+		top:       param.GetTop(),
+		name:      param.GetName(),
+	}
+
+	blobs := param.GetBlobs()
+	if len(blobs) > 0 {
+		weight, err := blob.FromProto(blobs[0])
+		if err != nil {
+			return nil, err
+		}
+		deconv.weight = weight
+	}
+	if deconv.biasTerm && len(blobs) > 1 {
+		bias, err := blob.FromProto(blobs[1])
+		if err != nil {
+			return nil, err
+		}
+		if int(bias.Capacity()) != deconv.numOutput {
+			return nil, fmt.Errorf("create deconvolution layer %s fail, bias shape %v for num_output %d", param.GetName(), bias.Shape(), deconv.numOutput)
+		}
+		deconv.bias = bias
+	}
+
+	return deconv, nil
+}
+
+func (deconv *DeconvLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return deconv.ForwardContext(context.Background(), bottom)
+}
+
+// ForwardContext is Forward that stops with ctx.Err() once ctx is done, the
+// context is checked for every channel of every image
+func (deconv *DeconvLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	if deconv.weight == nil || (deconv.biasTerm && deconv.bias == nil) {
+		return nil, fmt.Errorf("deconvolution layer %s: no learned parameters, copy the trained layers or init the blobs first", deconv.name)
+	}
+
+	top := []*blob.Blob{}
+	for _, v := range bottom {
+		data, err := deconv.forward(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		top = append(top, data)
+	}
+
+	return top, nil
+}
+
+// InitBlobs fills the weight and bias not loaded from a trained model with the
+// weight_filler and bias_filler of the convolution parameters
+func (deconv *DeconvLayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	if deconv.weight == nil {
+		shape := []int64{
+			bottom[0].Channels(),
+			int64(deconv.numOutput / deconv.group),
+			int64(deconv.param.kernel[0]),
+			int64(deconv.param.kernel[1]),
+		}
+		filler := deconv.convParam.GetWeightFiller()
+		if filler == nil {
+			filler = defaultWeightFiller
+		}
+		weight, err := newFilledBlob(shape, filler, rng)
+		if err != nil {
+			return nil, err
+		}
+		deconv.weight = weight
+	}
+
+	if deconv.bias == nil && deconv.biasTerm {
+		bias, err := newFilledBlob([]int64{int64(deconv.numOutput)}, deconv.convParam.GetBiasFiller(), rng)
+		if err != nil {
+			return nil, err
+		}
+		deconv.bias = bias
+	}
+
+	if deconv.bias == nil {
+		return []*blob.Blob{deconv.weight}, nil
+	}
+	return []*blob.Blob{deconv.weight, deconv.bias}, nil
+}
+
+func (deconv *DeconvLayer) Type() string {
+	return deconv.name
+}
+
+func (deconv *DeconvLayer) Bottom() []string {
+	return deconv.bottom
+}
+
+func (deconv *DeconvLayer) Top() []string {
+	return deconv.top
+}
+
+func (deconv *DeconvLayer) forward(ctx context.Context, bottom *blob.Blob) (*blob.Blob, error) {
+	if bottom.AxesNum() != 4 {
+		return nil, fmt.Errorf("deconvolution layer %s: bottom shape %v, expect N x C x H x W", deconv.name, bottom.Shape())
+	}
+
+	num := int(bottom.Num())
+	channels := int(bottom.Channels())
+	height := int(bottom.Height())
+	width := int(bottom.Width())
+	if channels%deconv.group != 0 {
+		return nil, fmt.Errorf("deconvolution layer %s: %d channels not divisible by group %d", deconv.name, channels, deconv.group)
+	}
+
+	p := deconv.param
+	groupIn := channels / deconv.group
+	groupOut := deconv.numOutput / deconv.group
+	if int(deconv.weight.Capacity()) != channels*groupOut*p.kernel[0]*p.kernel[1] {
+		return nil, fmt.Errorf("deconvolution layer %s: weight shape %v, expect %v", deconv.name, deconv.weight.Shape(),
+			[]int{channels, groupOut, p.kernel[0], p.kernel[1]})
+	}
+
+	outH := p.stride[0]*(height-1) + p.dilation[0]*(p.kernel[0]-1) + 1 - 2*p.pad[0]
+	outW := p.stride[1]*(width-1) + p.dilation[1]*(p.kernel[1]-1) + 1 - 2*p.pad[1]
+	if outH <= 0 || outW <= 0 {
+		return nil, fmt.Errorf("deconvolution layer %s: output size %dx%d for bottom shape %v", deconv.name, outH, outW, bottom.Shape())
+	}
+
+	result, err := blob.NewContext(ctx, []int64{int64(num), int64(deconv.numOutput), int64(outH), int64(outW)})
+	if err != nil {
+		return nil, err
+	}
+
+	src := bottom.Data()
+	dst := result.Data()
+	weight := deconv.weight.Data()
+	kernelSize := p.kernel[0] * p.kernel[1]
+	for n := 0; n < num; n++ {
+		for c := 0; c < channels; c++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			g := c / groupIn
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					v := src[((n*channels+c)*height+y)*width+x]
+					if v == 0 {
+						continue
+					}
+					// scatter the value through the kernel of every output
+					// channel of the group
+					for co := 0; co < groupOut; co++ {
+						o := g*groupOut + co
+						out := dst[(n*deconv.numOutput+o)*outH*outW:]
+						w := weight[(c*groupOut+co)*kernelSize:]
+						for ky := 0; ky < p.kernel[0]; ky++ {
+							oy := y*p.stride[0] - p.pad[0] + ky*p.dilation[0]
+							if oy < 0 || oy >= outH {
+								continue
+							}
+							for kx := 0; kx < p.kernel[1]; kx++ {
+								ox := x*p.stride[1] - p.pad[1] + kx*p.dilation[1]
+								if ox < 0 || ox >= outW {
+									continue
+								}
+								out[oy*outW+ox] += v * w[ky*p.kernel[1]+kx]
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if deconv.biasTerm {
+		addBias(dst, dst, deconv.bias.Data(), num, deconv.numOutput, outH*outW)
+	}
+
+	log.Println(deconv.Type(), bottom.Shape(), "->", result.Shape())
+
+	return result, nil
+}
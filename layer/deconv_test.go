@@ -0,0 +1,164 @@
+package layer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestDeconvLayer(t *testing.T) {
+	// expected outputs computed as Caffe's col2im of the transposed weight
+	// product
+	tests := []struct {
+		param  *pb.ConvolutionParameter
+		bottom []int64
+		weight *pb.BlobProto
+		bias   *pb.BlobProto
+		shape  []int64
+		data   []float64
+	}{
+		{
+			&pb.ConvolutionParameter{NumOutput: proto.Uint32(1), KernelSize: []uint32{2}, BiasTerm: proto.Bool(false)},
+			[]int64{1, 1, 2, 2},
+			&pb.BlobProto{Shape: &pb.BlobShape{Dim: []int64{1, 1, 2, 2}}, Data: []float32{1, 2, 3, 4}},
+			nil,
+			[]int64{1, 1, 3, 3},
+			[]float64{0, 1, 2, 2, 10, 10, 6, 17, 12},
+		},
+		{
+			&pb.ConvolutionParameter{NumOutput: proto.Uint32(1), KernelSize: []uint32{2}, Stride: []uint32{2}},
+			[]int64{1, 1, 2, 2},
+			&pb.BlobProto{Shape: &pb.BlobShape{Dim: []int64{1, 1, 2, 2}}, Data: []float32{1, 2, 3, 4}},
+			&pb.BlobProto{Shape: &pb.BlobShape{Dim: []int64{1}}, Data: []float32{0.5}},
+			[]int64{1, 1, 4, 4},
+			[]float64{0.5, 0.5, 1.5, 2.5, 0.5, 0.5, 3.5, 4.5, 2.5, 4.5, 3.5, 6.5, 6.5, 8.5, 9.5, 12.5},
+		},
+		{
+			&pb.ConvolutionParameter{
+				NumOutput: proto.Uint32(2), Group: proto.Uint32(2), BiasTerm: proto.Bool(false),
+				KernelH: proto.Uint32(3), KernelW: proto.Uint32(2),
+				StrideH: proto.Uint32(2), StrideW: proto.Uint32(1),
+				PadH: proto.Uint32(1), PadW: proto.Uint32(0),
+			},
+			[]int64{1, 2, 2, 2},
+			&pb.BlobProto{Shape: &pb.BlobShape{Dim: []int64{2, 1, 3, 2}}, Data: []float32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+			nil,
+			[]int64{1, 2, 3, 3},
+			[]float64{0, 2, 3, 0, 6, 8, 4, 12, 9, 32, 76, 45, 76, 178, 104, 48, 110, 63},
+		},
+		{
+			&pb.ConvolutionParameter{NumOutput: proto.Uint32(3), KernelSize: []uint32{2}, Dilation: []uint32{2}},
+			[]int64{1, 2, 2, 2},
+			&pb.BlobProto{
+				Shape: &pb.BlobShape{Dim: []int64{2, 3, 2, 2}},
+				Data:  []float32{-2, -1, 0, 1, 2, -2, -1, 0, 1, 2, -2, -1, 0, 1, 2, -2, -1, 0, 1, 2, -2, -1, 0, 1},
+			},
+			&pb.BlobProto{Shape: &pb.BlobShape{Dim: []int64{3}}, Data: []float32{1, -1, 0}},
+			[]int64{1, 3, 4, 4},
+			[]float64{
+				1, -1, 5, 5, -3, -5, 5, 5, 9, 11, -7, -8, 13, 15, -9, -10,
+				-5, -4, -1, -3, -3, -2, -5, -7, 3, 3, 7, 9, 3, 3, 11, 13,
+				-8, -9, -4, -3, -10, -11, -2, -1, 0, -2, 4, 4, -4, -6, 4, 4,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		blobs := []*pb.BlobProto{test.weight}
+		if test.bias != nil {
+			blobs = append(blobs, test.bias)
+		}
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:             proto.String("deconv"),
+			Type:             proto.String("Deconvolution"),
+			ConvolutionParam: test.param,
+			Blobs:            blobs,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		top, err := l.Forward([]*blob.Blob{rangeBlob(t, test.bottom, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Errorf("test %d: shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Errorf("test %d: data %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
+
+func TestDeconvLayerBilinearUpsample(t *testing.T) {
+	// the FCN upsampling: a bilinear kernel 4, stride 2 and pad 1 per channel
+	// doubles the size and keeps a constant bottom constant inside
+	l, err := NewDeconvolutionLayer(&pb.LayerParameter{
+		Name: proto.String("upscore"),
+		ConvolutionParam: &pb.ConvolutionParameter{
+			NumOutput:    proto.Uint32(2),
+			Group:        proto.Uint32(2),
+			KernelSize:   []uint32{4},
+			Stride:       []uint32{2},
+			Pad:          []uint32{1},
+			BiasTerm:     proto.Bool(false),
+			WeightFiller: &pb.FillerParameter{Type: proto.String("bilinear")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bottom, err := blob.Init([]int64{1, 2, 3, 3}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Forward([]*blob.Blob{bottom}); err == nil {
+		t.Fatal("expect error without weight")
+	}
+	if _, err := l.InitBlobs([]*blob.Blob{bottom}, rand.New(rand.NewSource(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	top, err := l.Forward([]*blob.Blob{bottom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []int64{1, 2, 6, 6}; !equalShape(top[0].Shape(), expect) {
+		t.Fatalf("shape %v, expect %v", top[0].Shape(), expect)
+	}
+	edge := []float64{0.75, 1, 1, 1, 1, 0.75}
+	expect := []float64{}
+	for c := 0; c < 2; c++ {
+		for _, y := range edge {
+			for _, x := range edge {
+				expect = append(expect, y*x)
+			}
+		}
+	}
+	if !equalData(top[0].Data(), expect) {
+		t.Errorf("data %v, expect %v", top[0].Data(), expect)
+	}
+}
+
+func TestDeconvLayerInvalidParam(t *testing.T) {
+	for _, param := range []*pb.ConvolutionParameter{
+		nil,
+		{KernelSize: []uint32{2}},
+		{NumOutput: proto.Uint32(3), Group: proto.Uint32(2), KernelSize: []uint32{2}},
+		{NumOutput: proto.Uint32(1)},
+		{NumOutput: proto.Uint32(1), KernelSize: []uint32{2}, KernelH: proto.Uint32(2), KernelW: proto.Uint32(2)},
+		{NumOutput: proto.Uint32(1), KernelH: proto.Uint32(2)},
+		{NumOutput: proto.Uint32(1), KernelSize: []uint32{2, 2, 2}},
+		{NumOutput: proto.Uint32(1), KernelSize: []uint32{2}, Stride: []uint32{0}},
+	} {
+		if _, err := NewDeconvolutionLayer(&pb.LayerParameter{Name: proto.String("deconv"), ConvolutionParam: param}); err == nil {
+			t.Errorf("expect error for convolution param %v", param)
+		}
+	}
+}
@@ -15,7 +15,7 @@ type DropoutLayer struct {
 	name      string
 }
 
-func NewDropoutLayer(param *pb.V1LayerParameter) (Layer, error) {
+func NewDropoutLayer(param *pb.LayerParameter) (Layer, error) {
 	dropParam := param.GetDropoutParam()
 	if dropParam == nil {
 		return nil, errors.New("create dropout layer fail")
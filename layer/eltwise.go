@@ -11,11 +11,10 @@ import (
 type EltwiseLayer struct {
 	op            pb.EltwiseParameter_EltwiseOp
 	coeffs        []float64
-	maxIdx        *blob.Blob
 	stableProGrad bool
 }
 
-func NewEltwiseLayer(param *pb.V1LayerParameter) (*EltwiseLayer, error) {
+func NewEltwiseLayer(param *pb.LayerParameter) (*EltwiseLayer, error) {
 	eltwiseParam := param.GetEltwiseParam()
 	if eltwiseParam == nil {
 		return nil, errors.New("create eltwise layer fail, invalid parameter")
@@ -81,10 +80,6 @@ func (elt *EltwiseLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 		return top, nil
 
 	case pb.EltwiseParameter_MAX:
-		mask, err := blob.Init(bottom[0].Shape(), -1)
-		if err != nil {
-			return nil, err
-		}
 		top, err := blob.Init(bottom[0].Shape(), -math.MaxFloat64)
 		if err != nil {
 			return nil, err
@@ -98,10 +93,8 @@ func (elt *EltwiseLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 						data1 := bottom[1].Get(idxs)
 						if data0 > data1 {
 							top.Set(idxs, data0)
-							mask.Set(idxs, 0)
 						} else {
 							top.Set(idxs, data1)
-							mask.Set(idxs, 1)
 						}
 					}
 				}
@@ -118,7 +111,6 @@ func (elt *EltwiseLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 							data1 := top.Get(idxs)
 							if data0 > data1 {
 								top.Set(idxs, data0)
-								mask.Set(idxs, float64(i))
 							}
 						}
 					}
@@ -126,7 +118,6 @@ func (elt *EltwiseLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 			}
 		}
 
-		elt.maxIdx = mask
 		return []*blob.Blob{top}, nil
 	}
 
@@ -0,0 +1,36 @@
+package layer
+
+import (
+	"context"
+	"math"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// ELULayer computes the exponential linear unit y = x for x > 0 and
+// y = \alpha (\exp(x) - 1) otherwise
+type ELULayer struct {
+	neuron
+	alpha float64
+}
+
+func NewELULayer(param *pb.LayerParameter) (*ELULayer, error) {
+	return &ELULayer{
+		neuron: newNeuron(param),
+		alpha:  float64(param.GetEluParam().GetAlpha()),
+	}, nil
+}
+
+func (elu *ELULayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return elu.ForwardContext(context.Background(), bottom)
+}
+
+func (elu *ELULayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return elu.forward(ctx, bottom, func(x float64) float64 {
+		if x > 0 {
+			return x
+		}
+		return elu.alpha * math.Expm1(x)
+	})
+}
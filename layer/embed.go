@@ -0,0 +1,154 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// EmbedLayer looks up the rows of a input_dim x num_output weight for the
+// integer indices of the bottom, and adds a bias with bias_term, as
+// embed_layer.cpp. The top has the bottom shape with a trailing num_output
+// axis
+type EmbedLayer struct {
+	numOutput int
+	inputDim  int
+	biasTerm  bool
+	param     *pb.EmbedParameter
+	weight    *blob.Blob
+	bias      *blob.Blob
+	bottom    []string
+	top       []string
+	name      string
+}
+
+func NewEmbedLayer(param *pb.LayerParameter) (*EmbedLayer, error) {
+	embedParam := param.GetEmbedParam()
+	if embedParam.GetNumOutput() == 0 {
+		return nil, fmt.Errorf("create embed layer %s fail, num_output must be > 0", param.GetName())
+	}
+	if embedParam.GetInputDim() == 0 {
+		return nil, fmt.Errorf("create embed layer %s fail, input_dim must be > 0", param.GetName())
+	}
+
+	embed := &EmbedLayer{
+		numOutput: int(embedParam.GetNumOutput()),
+		inputDim:  int(embedParam.GetInputDim()),
+		biasTerm:  embedParam.GetBiasTerm(),
+		param:     embedParam,
+		bottom:    param.GetBottom(),
+		top:       param.GetTop(),
+		name:      param.GetName(),
+	}
+
+	blobs := param.GetBlobs()
+	if len(blobs) > 0 {
+		weight, err := blob.FromProto(blobs[0])
+		if err != nil {
+			return nil, err
+		}
+		if int(weight.Capacity()) != embed.inputDim*embed.numOutput {
+			return nil, fmt.Errorf("create embed layer %s fail, weight shape %v, expect %d x %d", param.GetName(), weight.Shape(), embed.inputDim, embed.numOutput)
+		}
+		embed.weight = weight
+	}
+	if embed.biasTerm && len(blobs) > 1 {
+		bias, err := blob.FromProto(blobs[1])
+		if err != nil {
+			return nil, err
+		}
+		if int(bias.Capacity()) != embed.numOutput {
+			return nil, fmt.Errorf("create embed layer %s fail, bias shape %v, expect %d", param.GetName(), bias.Shape(), embed.numOutput)
+		}
+		embed.bias = bias
+	}
+
+	return embed, nil
+}
+
+func (embed *EmbedLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return embed.ForwardContext(context.Background(), bottom)
+}
+
+func (embed *EmbedLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	if embed.weight == nil || (embed.biasTerm && embed.bias == nil) {
+		return nil, fmt.Errorf("embed layer %s: no learned parameters, copy the trained layers or init the blobs first", embed.name)
+	}
+
+	shape := make([]int64, bottom[0].AxesNum(), bottom[0].AxesNum()+1)
+	copy(shape, bottom[0].Shape())
+	shape = append(shape, int64(embed.numOutput))
+	top, err := newTop(ctx, shape)
+	if err != nil {
+		return nil, err
+	}
+
+	data := top.Data()
+	weight := embed.weight.Data()
+	for n, v := range bottom[0].Data() {
+		index := int(v)
+		if float64(index) != v || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("embed layer %s: non-integer index %v", embed.name, v)
+		}
+		if index < 0 || index >= embed.inputDim {
+			return nil, fmt.Errorf("embed layer %s: index %d out of input_dim %d", embed.name, index, embed.inputDim)
+		}
+
+		row := data[n*embed.numOutput : (n+1)*embed.numOutput]
+		copy(row, weight[index*embed.numOutput:(index+1)*embed.numOutput])
+		if embed.biasTerm {
+			for i, b := range embed.bias.Data() {
+				row[i] += b
+			}
+		}
+	}
+
+	logForward(embed.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+// InitBlobs fills the weight and bias not loaded from a trained model with the
+// weight_filler and bias_filler of the embed parameters
+func (embed *EmbedLayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	if embed.weight == nil {
+		filler := embed.param.GetWeightFiller()
+		if filler == nil {
+			filler = defaultWeightFiller
+		}
+		weight, err := newFilledBlob([]int64{int64(embed.inputDim), int64(embed.numOutput)}, filler, rng)
+		if err != nil {
+			return nil, err
+		}
+		embed.weight = weight
+	}
+
+	if embed.bias == nil && embed.biasTerm {
+		bias, err := newFilledBlob([]int64{int64(embed.numOutput)}, embed.param.GetBiasFiller(), rng)
+		if err != nil {
+			return nil, err
+		}
+		embed.bias = bias
+	}
+
+	if embed.bias == nil {
+		return []*blob.Blob{embed.weight}, nil
+	}
+	return []*blob.Blob{embed.weight, embed.bias}, nil
+}
+
+func (embed *EmbedLayer) Type() string {
+	return embed.name
+}
+
+func (embed *EmbedLayer) Bottom() []string {
+	return embed.bottom
+}
+
+func (embed *EmbedLayer) Top() []string {
+	return embed.top
+}
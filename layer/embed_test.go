@@ -0,0 +1,82 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestEmbedLayer(t *testing.T) {
+	weight := &pb.BlobProto{Shape: &pb.BlobShape{Dim: []int64{3, 2}}, Data: []float32{0, 1, 2, 3, 4, 5}}
+	bias := &pb.BlobProto{Shape: &pb.BlobShape{Dim: []int64{2}}, Data: []float32{10, 20}}
+	tests := []struct {
+		param *pb.EmbedParameter
+		blobs []*pb.BlobProto
+		data  []float64
+	}{
+		{
+			&pb.EmbedParameter{NumOutput: proto.Uint32(2), InputDim: proto.Uint32(3)},
+			[]*pb.BlobProto{weight, bias},
+			[]float64{14, 25, 10, 21, 12, 23, 14, 25},
+		},
+		{
+			&pb.EmbedParameter{NumOutput: proto.Uint32(2), InputDim: proto.Uint32(3), BiasTerm: proto.Bool(false)},
+			[]*pb.BlobProto{weight},
+			[]float64{4, 5, 0, 1, 2, 3, 4, 5},
+		},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:       proto.String("embed"),
+			Type:       proto.String("Embed"),
+			EmbedParam: test.param,
+			Blobs:      test.blobs,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bottom, err := blob.New([]int64{2, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(bottom.Data(), []float64{2, 0, 1, 2})
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []int64{2, 2, 2}; !equalShape(top[0].Shape(), expect) {
+			t.Errorf("test %d: shape %v, expect %v", i, top[0].Shape(), expect)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Errorf("test %d: data %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
+
+func TestEmbedLayerInvalidIndex(t *testing.T) {
+	l, err := NewEmbedLayer(&pb.LayerParameter{
+		Name:       proto.String("embed"),
+		EmbedParam: &pb.EmbedParameter{NumOutput: proto.Uint32(2), InputDim: proto.Uint32(3), BiasTerm: proto.Bool(false)},
+		Blobs: []*pb.BlobProto{
+			{Shape: &pb.BlobShape{Dim: []int64{3, 2}}, Data: []float32{0, 1, 2, 3, 4, 5}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, index := range []float64{3, -1, 1.5} {
+		bottom, err := blob.Init([]int64{1}, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Forward([]*blob.Blob{bottom}); err == nil {
+			t.Errorf("expect error for index %v", index)
+		}
+	}
+}
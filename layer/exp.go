@@ -0,0 +1,52 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// ExpLayer computes y = \gamma ^ {\alpha x + \beta} for the base \gamma, the
+// scale \alpha and the shift \beta. The base -1, the default, stands for e
+type ExpLayer struct {
+	neuron
+	innerScale float64
+	outerScale float64
+}
+
+func NewExpLayer(param *pb.LayerParameter) (*ExpLayer, error) {
+	expParam := param.GetExpParam()
+	base := float64(expParam.GetBase())
+	if base != -1 && base <= 0 {
+		return nil, fmt.Errorf("create exp layer %s fail, base %g should be -1 or positive", param.GetName(), base)
+	}
+
+	logBase := 1.0
+	if base != -1 {
+		logBase = math.Log(base)
+	}
+	shift := float64(expParam.GetShift())
+	outerScale := 1.0
+	if shift != 0 {
+		outerScale = math.Exp(logBase * shift)
+	}
+
+	return &ExpLayer{
+		neuron:     newNeuron(param),
+		innerScale: logBase * float64(expParam.GetScale()),
+		outerScale: outerScale,
+	}, nil
+}
+
+func (e *ExpLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return e.ForwardContext(context.Background(), bottom)
+}
+
+func (e *ExpLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return e.forward(ctx, bottom, func(x float64) float64 {
+		return e.outerScale * math.Exp(e.innerScale*x)
+	})
+}
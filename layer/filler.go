@@ -0,0 +1,141 @@
+package layer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// Initializer is implemented by layers with learnable blobs. InitBlobs fills
+// the blobs which were not loaded from a trained model using the fillers of
+// the layer parameters, the bottom blobs give the shapes the layer will see
+// in Forward. It returns all learnable blobs of the layer in the order of the
+// layer parameters blobs. It modifies the layer, so it must not run
+// concurrently with Forward
+type Initializer interface {
+	InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error)
+}
+
+// defaultWeightFiller is used for weights of layers without weight_filler, so
+// that a net set up without trained model does not compute on all zeros
+var defaultWeightFiller = &pb.FillerParameter{
+	Type: proto.String("gaussian"),
+	Std:  proto.Float32(0.01),
+}
+
+// newFilledBlob returns a blob of the given shape filled by the filler
+// parameter, a nil parameter means the default constant 0 filler
+func newFilledBlob(shape []int64, param *pb.FillerParameter, rng *rand.Rand) (*blob.Blob, error) {
+	b, err := blob.New(shape)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fill(b, param, rng); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// fill fills the blob data as Caffe's filler.hpp does for the filler type
+func fill(b *blob.Blob, param *pb.FillerParameter, rng *rand.Rand) error {
+	data := b.Data()
+	shape := b.Shape()
+
+	// fan in and fan out are computed on the legacy num and channels axes
+	num, channels := int64(1), int64(1)
+	if len(shape) > 0 {
+		num = shape[0]
+	}
+	if len(shape) > 1 {
+		channels = shape[1]
+	}
+	fanIn := float64(b.Capacity() / num)
+	fanOut := float64(b.Capacity() / channels)
+	n := fanIn
+	switch param.GetVarianceNorm() {
+	case pb.FillerParameter_FAN_OUT:
+		n = fanOut
+	case pb.FillerParameter_AVERAGE:
+		n = (fanIn + fanOut) / 2
+	}
+
+	switch param.GetType() {
+	case "constant":
+		for i := range data {
+			data[i] = float64(param.GetValue())
+		}
+
+	case "uniform":
+		min, max := float64(param.GetMin()), float64(param.GetMax())
+		for i := range data {
+			data[i] = min + rng.Float64()*(max-min)
+		}
+
+	case "gaussian":
+		mean, std := float64(param.GetMean()), float64(param.GetStd())
+		for i := range data {
+			data[i] = mean + rng.NormFloat64()*std
+		}
+		// sparse keeps on average param.sparse non-zero weights per output
+		if sparse := param.GetSparse(); sparse >= 0 {
+			nonZeroProb := float64(sparse) / float64(num)
+			for i := range data {
+				if rng.Float64() >= nonZeroProb {
+					data[i] = 0
+				}
+			}
+		}
+
+	case "positive_unitball":
+		dim := int(fanIn)
+		for i := range data {
+			data[i] = rng.Float64()
+		}
+		for i := 0; i < int(num); i++ {
+			var sum float64
+			for j := 0; j < dim; j++ {
+				sum += data[i*dim+j]
+			}
+			for j := 0; j < dim; j++ {
+				data[i*dim+j] /= sum
+			}
+		}
+
+	case "xavier":
+		scale := math.Sqrt(3 / n)
+		for i := range data {
+			data[i] = -scale + rng.Float64()*2*scale
+		}
+
+	case "msra":
+		std := math.Sqrt(2 / n)
+		for i := range data {
+			data[i] = rng.NormFloat64() * std
+		}
+
+	case "bilinear":
+		if len(shape) != 4 || shape[2] != shape[3] {
+			return fmt.Errorf("bilinear filler needs a 4 axes blob with square kernel, got shape %v", shape)
+		}
+		width, height := int(shape[3]), int(shape[2])
+		f := math.Ceil(float64(width) / 2)
+		c := (2*f - 1 - float64(int(f)%2)) / (2 * f)
+		for i := range data {
+			x := float64(i % width)
+			y := float64((i / width) % height)
+			data[i] = (1 - math.Abs(x/f-c)) * (1 - math.Abs(y/f-c))
+		}
+
+	default:
+		return fmt.Errorf("unknown filler type %s", param.GetType())
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package layer
+
+import (
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// FlattenLayer reshapes the bottom by merging the axes from axis to end_axis
+// into one, e.g. a N x C x H x W blob into a N x CHW blob by default
+type FlattenLayer struct {
+	axis    int
+	endAxis int
+	bottom  []string
+	top     []string
+	name    string
+}
+
+func NewFlattenLayer(param *pb.LayerParameter) (*FlattenLayer, error) {
+	flattenParam := param.GetFlattenParam()
+	if flattenParam == nil {
+		flattenParam = &pb.FlattenParameter{}
+	}
+
+	return &FlattenLayer{
+		axis:    int(flattenParam.GetAxis()),
+		endAxis: int(flattenParam.GetEndAxis()),
+		bottom:  param.GetBottom(),
+		top:     param.GetTop(),
+		name:    param.GetName(),
+	}, nil
+}
+
+func (flatten *FlattenLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	axis, err := bottom[0].CanonicalAxisIndex(flatten.axis)
+	if err != nil {
+		return nil, fmt.Errorf("flatten layer %s: %s", flatten.name, err)
+	}
+	endAxis, err := bottom[0].CanonicalAxisIndex(flatten.endAxis)
+	if err != nil {
+		return nil, fmt.Errorf("flatten layer %s: %s", flatten.name, err)
+	}
+	if endAxis < axis {
+		return nil, fmt.Errorf("flatten layer %s: end_axis %d before axis %d", flatten.name, endAxis, axis)
+	}
+
+	shape := []int64{}
+	shape = append(shape, bottom[0].Shape()[:axis]...)
+	shape = append(shape, bottom[0].CountRange(axis, endAxis+1))
+	shape = append(shape, bottom[0].Shape()[endAxis+1:]...)
+
+	top, err := bottom[0].Reshape(shape)
+	if err != nil {
+		return nil, err
+	}
+
+	logForward(flatten.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+func (flatten *FlattenLayer) Type() string {
+	return flatten.name
+}
+
+func (flatten *FlattenLayer) Bottom() []string {
+	return flatten.bottom
+}
+
+func (flatten *FlattenLayer) Top() []string {
+	return flatten.top
+}
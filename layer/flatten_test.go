@@ -0,0 +1,44 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestFlattenLayer(t *testing.T) {
+	tests := []struct {
+		param *pb.FlattenParameter
+		shape []int64
+	}{
+		{nil, []int64{2, 60}},
+		{&pb.FlattenParameter{Axis: proto.Int32(2)}, []int64{2, 3, 20}},
+		{&pb.FlattenParameter{Axis: proto.Int32(1), EndAxis: proto.Int32(2)}, []int64{2, 12, 5}},
+		{&pb.FlattenParameter{Axis: proto.Int32(0), EndAxis: proto.Int32(-2)}, []int64{24, 5}},
+	}
+
+	bottom := rangeBlob(t, []int64{2, 3, 4, 5}, 0)
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:         proto.String("flatten"),
+			Type:         proto.String("Flatten"),
+			FlattenParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Fatalf("test %d: top shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), bottom.Data()) {
+			t.Fatalf("test %d: flatten changes the data", i)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package layer
 import (
 	"errors"
 	"log"
+	"math/rand"
 
 	"github.com/cvley/gocaffe/blob"
 	pb "github.com/cvley/gocaffe/proto"
@@ -11,6 +12,7 @@ import (
 type InnerProductLayer struct {
 	n         int
 	biasTerm  bool
+	param     *pb.InnerProductParameter
 	weight    *blob.Blob
 	bias      *blob.Blob
 	transpose bool
@@ -18,9 +20,13 @@ type InnerProductLayer struct {
 	bottom    []string
 	top       []string
 	name      string
+
+	// fused ReLU applied to the top, set by FuseReLU
+	fuseReLU      bool
+	negativeSlope float64
 }
 
-func NewInnerProductLayer(param *pb.V1LayerParameter) (*InnerProductLayer, error) {
+func NewInnerProductLayer(param *pb.LayerParameter) (*InnerProductLayer, error) {
 	innerParam := param.GetInnerProductParam()
 	if innerParam == nil {
 		return nil, errors.New("create inner product layer fail, invalid param")
@@ -50,6 +56,7 @@ func NewInnerProductLayer(param *pb.V1LayerParameter) (*InnerProductLayer, error
 
 	return &InnerProductLayer{
 		biasTerm:  biasTerm,
+		param:     innerParam,
 		weight:    weight,
 		bias:      bias,
 		transpose: transpose,
@@ -112,6 +119,15 @@ func (inner *InnerProductLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, erro
 		}
 	}
 
+	if inner.fuseReLU {
+		data := top.Data()
+		for i, v := range data {
+			if v < 0 {
+				data[i] = v * inner.negativeSlope
+			}
+		}
+	}
+
 	if inner.Type() == "fc8" {
 		log.Println("MMul top", top.DataString())
 	}
@@ -121,6 +137,46 @@ func (inner *InnerProductLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, erro
 	return []*blob.Blob{top}, nil
 }
 
+// InitBlobs fills the weight and bias not loaded from a trained model with the
+// weight_filler and bias_filler of the inner product parameters
+func (inner *InnerProductLayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	if inner.weight == nil {
+		K := int64(1)
+		shape := bottom[0].Shape()
+		for i := inner.axis; i < len(shape); i++ {
+			K *= shape[i]
+		}
+		filler := inner.param.GetWeightFiller()
+		if filler == nil {
+			filler = defaultWeightFiller
+		}
+		weight, err := newFilledBlob([]int64{1, 1, int64(inner.n), K}, filler, rng)
+		if err != nil {
+			return nil, err
+		}
+		inner.weight = weight
+	}
+
+	if inner.bias == nil && inner.biasTerm {
+		bias, err := newFilledBlob([]int64{1, 1, 1, int64(inner.n)}, inner.param.GetBiasFiller(), rng)
+		if err != nil {
+			return nil, err
+		}
+		inner.bias = bias
+	}
+
+	if inner.bias == nil {
+		return []*blob.Blob{inner.weight}, nil
+	}
+	return []*blob.Blob{inner.weight, inner.bias}, nil
+}
+
+// FuseReLU makes Forward apply a ReLU with the negative slope to the top
+func (inner *InnerProductLayer) FuseReLU(negativeSlope float64) {
+	inner.fuseReLU = true
+	inner.negativeSlope = negativeSlope
+}
+
 // Type of Layer
 func (inner *InnerProductLayer) Type() string {
 	return inner.name
@@ -1,6 +1,7 @@
 package layer
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -13,6 +14,9 @@ var (
 	LayerRegister LayerRegistry
 )
 
+// Layer is the interface implemented by all layers. Forward must not modify
+// the layer itself, so that one layer can be shared by goroutines running
+// Forward concurrently; any scratch state is kept local to the call
 type Layer interface {
 	Forward([]*blob.Blob) ([]*blob.Blob, error)
 	Type() string
@@ -20,6 +24,42 @@ type Layer interface {
 	Top() []string
 }
 
+// ContextLayer is implemented by layers which can be interrupted and whose
+// tops can be recycled. Their Forward is ForwardContext with
+// context.Background(). ForwardContext returns ctx.Err() once the context is
+// cancelled or its deadline exceeded, it checks ctx before allocating its
+// tops, and layers with long computations also check it while they compute.
+// It allocates its tops with blob.NewContext, so that the net can recycle the
+// storage of dead blobs through a blob.Pool carried by ctx. Tops which are
+// the bottom itself or share its data are not allocated
+type ContextLayer interface {
+	Layer
+	ForwardContext(context.Context, []*blob.Blob) ([]*blob.Blob, error)
+}
+
+// newTop returns a top of the shape for ForwardContext, allocated from the
+// pool of ctx if any, or ctx.Err() once ctx is done
+func newTop(ctx context.Context, shape []int64) (*blob.Blob, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return blob.NewContext(ctx, shape)
+}
+
+// logForward logs the bottom and top shapes of the layer forward
+func logForward(name string, bottom, top *blob.Blob) {
+	log.Println(name, bottom.Shape(), "->", top.Shape())
+}
+
+// ReLUFuser is implemented by layers which can apply a ReLU with the given
+// negative slope to their top in their own Forward, so that the net optimizer
+// can drop the ReLU layer following them. It modifies the layer, so it must
+// not run concurrently with Forward
+type ReLUFuser interface {
+	FuseReLU(negativeSlope float64)
+}
+
 // NeuronLayer is the interface for layers that take one blob as input and
 // produce one equally-sized blob as output, where each element of the output
 // depends only on the corresponding input element
@@ -30,13 +70,17 @@ type NeuronLayer interface {
 	Top() []string
 }
 
-type Creator func(*pb.V1LayerParameter) (Layer, error)
+// Creator returns a layer set up from the layer parameters. Layers defined in
+// the deprecated V1 format are upgraded to LayerParameter by the net, with
+// the V1 enum name, e.g. CONVOLUTION, as type
+type Creator func(*pb.LayerParameter) (Layer, error)
 
 type LayerRegistry map[string]Creator
 
 func init() {
 	LayerRegister = make(LayerRegistry)
 	LayerRegister.AddCreator("CONVOLUTION", GetConvolutionLayer)
+	LayerRegister.AddCreator("DECONVOLUTION", GetDeconvolutionLayer)
 	LayerRegister.AddCreator("RELU", GetReLULayer)
 	LayerRegister.AddCreator("POOLING", GetPoolLayer)
 	LayerRegister.AddCreator("LRN", GetLRNLayer)
@@ -44,21 +88,64 @@ func init() {
 	LayerRegister.AddCreator("DROPOUT", GetDropoutLayer)
 	LayerRegister.AddCreator("SOFTMAX", GetSoftmaxLayer)
 	LayerRegister.AddCreator("SOFTMAX_LOSS", GetSoftmaxLayer)
+	LayerRegister.AddCreator("CONCAT", GetConcatLayer)
+	LayerRegister.AddCreator("SIGMOID", GetSigmoidLayer)
+	LayerRegister.AddCreator("TANH", GetTanHLayer)
+	LayerRegister.AddCreator("ABSVAL", GetAbsValLayer)
+	LayerRegister.AddCreator("BNLL", GetBNLLLayer)
+	LayerRegister.AddCreator("EXP", GetExpLayer)
+	LayerRegister.AddCreator("POWER", GetPowerLayer)
+	LayerRegister.AddCreator("THRESHOLD", GetThresholdLayer)
+	LayerRegister.AddCreator("SLICE", GetSliceLayer)
+	LayerRegister.AddCreator("FLATTEN", GetFlattenLayer)
+	LayerRegister.AddCreator("ARGMAX", GetArgMaxLayer)
+	LayerRegister.AddCreator("ACCURACY", GetAccuracyLayer)
+	LayerRegister.AddCreator("MVN", GetMVNLayer)
+
+	LayerRegister.AddCreator("Convolution", GetConvolutionLayer)
+	LayerRegister.AddCreator("Deconvolution", GetDeconvolutionLayer)
+	LayerRegister.AddCreator("ReLU", GetReLULayer)
+	LayerRegister.AddCreator("Pooling", GetPoolLayer)
+	LayerRegister.AddCreator("InnerProduct", GetInnerProductLayer)
+	LayerRegister.AddCreator("Dropout", GetDropoutLayer)
+	LayerRegister.AddCreator("Softmax", GetSoftmaxLayer)
+	LayerRegister.AddCreator("SoftmaxWithLoss", GetSoftmaxLayer)
+	LayerRegister.AddCreator("Concat", GetConcatLayer)
+	LayerRegister.AddCreator("Slice", GetSliceLayer)
+	LayerRegister.AddCreator("Flatten", GetFlattenLayer)
+	LayerRegister.AddCreator("Reshape", GetReshapeLayer)
+	LayerRegister.AddCreator("Crop", GetCropLayer)
+	LayerRegister.AddCreator("BatchNorm", GetBatchNormLayer)
+	LayerRegister.AddCreator("Scale", GetScaleLayer)
+	LayerRegister.AddCreator("Bias", GetBiasLayer)
+	LayerRegister.AddCreator("PReLU", GetPReLULayer)
+	LayerRegister.AddCreator("ArgMax", GetArgMaxLayer)
+	LayerRegister.AddCreator("Accuracy", GetAccuracyLayer)
+	LayerRegister.AddCreator("Reduction", GetReductionLayer)
+	LayerRegister.AddCreator("Tile", GetTileLayer)
+	LayerRegister.AddCreator("Embed", GetEmbedLayer)
+	LayerRegister.AddCreator("SPP", GetSPPLayer)
 
 	LayerRegister.AddCreator("Sigmoid", GetSigmoidLayer)
 	LayerRegister.AddCreator("TanH", GetTanHLayer)
+	LayerRegister.AddCreator("AbsVal", GetAbsValLayer)
+	LayerRegister.AddCreator("Exp", GetExpLayer)
+	LayerRegister.AddCreator("Power", GetPowerLayer)
+	LayerRegister.AddCreator("Threshold", GetThresholdLayer)
+	LayerRegister.AddCreator("ELU", GetELULayer)
+	LayerRegister.AddCreator("Log", GetLogLayer)
 }
 
 func (r LayerRegistry) AddCreator(tp string, creator Creator) error {
 	if r.layerExist(tp) {
-		return fmt.Errorf("Layer type %s already registered.")
+		return fmt.Errorf("Layer type %s already registered.", tp)
 	}
 	r[tp] = creator
 	return nil
 }
 
-func (r LayerRegistry) CreateLayer(param *pb.V1LayerParameter) (Layer, error) {
-	tp := param.GetType().String()
+func (r LayerRegistry) CreateLayer(param *pb.LayerParameter) (Layer, error) {
+	tp := param.GetType()
 	if !r.layerExist(tp) {
 		return nil, fmt.Errorf("layer %s not exist", tp)
 	}
@@ -90,38 +177,134 @@ func (r LayerRegistry) layerExist(name string) bool {
 	return false
 }
 
-func GetConvolutionLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetConvolutionLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewConvolutionLayer(param)
 }
 
-func GetPoolLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetPoolLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewPoolingLayer(param)
 }
 
-func GetLRNLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetLRNLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewLRNLayer(param)
 }
 
-func GetReLULayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetReLULayer(param *pb.LayerParameter) (Layer, error) {
 	return NewReLULayer(param)
 }
 
-func GetSigmoidLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetSigmoidLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewSigmoidLayer(param)
 }
 
-func GetSoftmaxLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetSoftmaxLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewSoftmaxLayer(param)
 }
 
-func GetTanHLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetTanHLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewTanHLayer(param)
 }
 
-func GetInnerProductLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetInnerProductLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewInnerProductLayer(param)
 }
 
-func GetDropoutLayer(param *pb.V1LayerParameter) (Layer, error) {
+func GetDropoutLayer(param *pb.LayerParameter) (Layer, error) {
 	return NewDropoutLayer(param)
 }
+
+func GetConcatLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewConcatLayer(param)
+}
+
+func GetSliceLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewSliceLayer(param)
+}
+
+func GetFlattenLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewFlattenLayer(param)
+}
+
+func GetReshapeLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewReshapeLayer(param)
+}
+
+func GetCropLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewCropLayer(param)
+}
+
+func GetBatchNormLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewBatchNormLayer(param)
+}
+
+func GetScaleLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewScaleLayer(param)
+}
+
+func GetBiasLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewBiasLayer(param)
+}
+
+func GetPReLULayer(param *pb.LayerParameter) (Layer, error) {
+	return NewPReLULayer(param)
+}
+
+func GetAbsValLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewAbsValLayer(param)
+}
+
+func GetBNLLLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewBNLLLayer(param)
+}
+
+func GetELULayer(param *pb.LayerParameter) (Layer, error) {
+	return NewELULayer(param)
+}
+
+func GetExpLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewExpLayer(param)
+}
+
+func GetLogLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewLogLayer(param)
+}
+
+func GetPowerLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewPowerLayer(param)
+}
+
+func GetThresholdLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewThresholdLayer(param)
+}
+
+func GetArgMaxLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewArgMaxLayer(param)
+}
+
+func GetAccuracyLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewAccuracyLayer(param)
+}
+
+func GetMVNLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewMVNLayer(param)
+}
+
+func GetReductionLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewReductionLayer(param)
+}
+
+func GetTileLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewTileLayer(param)
+}
+
+func GetEmbedLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewEmbedLayer(param)
+}
+
+func GetDeconvolutionLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewDeconvolutionLayer(param)
+}
+
+func GetSPPLayer(param *pb.LayerParameter) (Layer, error) {
+	return NewSPPLayer(param)
+}
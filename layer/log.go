@@ -0,0 +1,49 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// LogLayer computes y = \log_{\gamma}(\alpha x + \beta) for the base \gamma,
+// the scale \alpha and the shift \beta. The base -1, the default, stands for e
+type LogLayer struct {
+	neuron
+	baseScale float64
+	scale     float64
+	shift     float64
+}
+
+func NewLogLayer(param *pb.LayerParameter) (*LogLayer, error) {
+	logParam := param.GetLogParam()
+	base := float64(logParam.GetBase())
+	if base != -1 && base <= 0 {
+		return nil, fmt.Errorf("create log layer %s fail, base %g should be -1 or positive", param.GetName(), base)
+	}
+
+	baseScale := 1.0
+	if base != -1 {
+		baseScale = 1 / math.Log(base)
+	}
+
+	return &LogLayer{
+		neuron:    newNeuron(param),
+		baseScale: baseScale,
+		scale:     float64(logParam.GetScale()),
+		shift:     float64(logParam.GetShift()),
+	}, nil
+}
+
+func (l *LogLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return l.ForwardContext(context.Background(), bottom)
+}
+
+func (l *LogLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return l.forward(ctx, bottom, func(x float64) float64 {
+		return math.Log(l.scale*x+l.shift) * l.baseScale
+	})
+}
@@ -22,7 +22,7 @@ type LrnLayer struct {
 	name   string
 }
 
-func NewLRNLayer(params *pb.V1LayerParameter) (Layer, error) {
+func NewLRNLayer(params *pb.LayerParameter) (Layer, error) {
 	param := params.GetLrnParam()
 	if param == nil {
 		return nil, errors.New("get LRN parameters fail")
@@ -118,7 +118,7 @@ func (lrn *LrnLayer) withinChannelForward(bottom []*blob.Blob) ([]*blob.Blob, er
 	// set up square layer to square the input
 	power := float32(2.0)
 	squareParam := &pb.PowerParameter{Power: &power}
-	powerLayer, err := NewPowerLayer(&pb.V1LayerParameter{PowerParam: squareParam})
+	powerLayer, err := NewPowerLayer(&pb.LayerParameter{PowerParam: squareParam})
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +136,7 @@ func (lrn *LrnLayer) withinChannelForward(bottom []*blob.Blob) ([]*blob.Blob, er
 		Pad:        &prePad,
 		KernelSize: &kernelSize,
 	}
-	poolLayer, err := NewPoolingLayer(&pb.V1LayerParameter{PoolingParam: poolParam})
+	poolLayer, err := NewPoolingLayer(&pb.LayerParameter{PoolingParam: poolParam})
 	if err != nil {
 		return nil, err
 	}
@@ -156,7 +156,7 @@ func (lrn *LrnLayer) withinChannelForward(bottom []*blob.Blob) ([]*blob.Blob, er
 		Shift: &shift,
 	}
 
-	powerLayer, err = NewPowerLayer(&pb.V1LayerParameter{PowerParam: powerParam})
+	powerLayer, err = NewPowerLayer(&pb.LayerParameter{PowerParam: powerParam})
 	if err != nil {
 		return nil, err
 	}
@@ -171,7 +171,7 @@ func (lrn *LrnLayer) withinChannelForward(bottom []*blob.Blob) ([]*blob.Blob, er
 	productParam := &pb.EltwiseParameter{
 		Operation: &op,
 	}
-	productLayer, err := NewEltwiseLayer(&pb.V1LayerParameter{EltwiseParam: productParam})
+	productLayer, err := NewEltwiseLayer(&pb.LayerParameter{EltwiseParam: productParam})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,99 @@
+package layer
+
+import (
+	"context"
+	"math"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// MVNLayer normalizes every image channel, or every image with
+// across_channels, to zero mean and, with normalize_variance, to unit
+// variance, as mvn_layer.cpp. Like Caffe, eps is added to the standard
+// deviation rather than to the variance
+type MVNLayer struct {
+	normalizeVariance bool
+	acrossChannels    bool
+	eps               float64
+	bottom            []string
+	top               []string
+	name              string
+}
+
+func NewMVNLayer(param *pb.LayerParameter) (*MVNLayer, error) {
+	mvnParam := param.GetMvnParam()
+	return &MVNLayer{
+		normalizeVariance: mvnParam.GetNormalizeVariance(),
+		acrossChannels:    mvnParam.GetAcrossChannels(),
+		eps:               float64(mvnParam.GetEps()),
+		bottom:            param.GetBottom(),
+		top:               param.GetTop(),
+		name:              param.GetName(),
+	}, nil
+}
+
+func (mvn *MVNLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return mvn.ForwardContext(context.Background(), bottom)
+}
+
+func (mvn *MVNLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	top, err := newTop(ctx, bottom[0].Shape())
+	if err != nil {
+		return nil, err
+	}
+
+	// the values are normalized by groups of dim values
+	num := int(bottom[0].ShapeOfIndex(0))
+	if !mvn.acrossChannels && bottom[0].AxesNum() > 1 {
+		num *= int(bottom[0].ShapeOfIndex(1))
+	}
+	dim := 0
+	if num > 0 {
+		dim = int(bottom[0].Capacity()) / num
+	}
+
+	src := bottom[0].Data()
+	data := top.Data()
+	for i := 0; i < num; i++ {
+		group := src[i*dim : (i+1)*dim]
+		out := data[i*dim : (i+1)*dim]
+
+		mean := 0.0
+		for _, v := range group {
+			mean += v
+		}
+		mean /= float64(dim)
+		for j, v := range group {
+			out[j] = v - mean
+		}
+
+		if !mvn.normalizeVariance {
+			continue
+		}
+		variance := 0.0
+		for _, v := range out {
+			variance += v * v
+		}
+		std := math.Sqrt(variance/float64(dim)) + mvn.eps
+		for j := range out {
+			out[j] /= std
+		}
+	}
+
+	logForward(mvn.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+func (mvn *MVNLayer) Type() string {
+	return mvn.name
+}
+
+func (mvn *MVNLayer) Bottom() []string {
+	return mvn.bottom
+}
+
+func (mvn *MVNLayer) Top() []string {
+	return mvn.top
+}
@@ -0,0 +1,68 @@
+package layer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestMVNLayer(t *testing.T) {
+	// 2 images of 2 channels x 2 values
+	values := []float64{1, 3, 10, 20, -4, 0, 5, 5}
+	tests := []struct {
+		param *pb.MVNParameter
+		data  []float64
+	}{
+		{
+			// defaults: per channel mean and variance, eps 1e-9 added to the
+			// standard deviation
+			nil,
+			[]float64{-1, 1, -1, 1, -1, 1, 0, 0},
+		},
+		{
+			&pb.MVNParameter{NormalizeVariance: proto.Bool(false)},
+			[]float64{-1, 1, -5, 5, -2, 2, 0, 0},
+		},
+		{
+			&pb.MVNParameter{AcrossChannels: proto.Bool(true), NormalizeVariance: proto.Bool(false)},
+			[]float64{-7.5, -5.5, 1.5, 11.5, -5.5, -1.5, 3.5, 3.5},
+		},
+		{
+			&pb.MVNParameter{AcrossChannels: proto.Bool(true), Eps: proto.Float32(0.5)},
+			[]float64{
+				-7.5 / (math.Sqrt(221.0/4) + 0.5), -5.5 / (math.Sqrt(221.0/4) + 0.5), 1.5 / (math.Sqrt(221.0/4) + 0.5), 11.5 / (math.Sqrt(221.0/4) + 0.5),
+				-5.5 / (math.Sqrt(57.0/4) + 0.5), -1.5 / (math.Sqrt(57.0/4) + 0.5), 3.5 / (math.Sqrt(57.0/4) + 0.5), 3.5 / (math.Sqrt(57.0/4) + 0.5),
+			},
+		},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:     proto.String("mvn"),
+			Type:     proto.String("MVN"),
+			MvnParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bottom, err := blob.New([]int64{2, 2, 1, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(bottom.Data(), values)
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, v := range top[0].Data() {
+			if math.Abs(v-test.data[j]) > 1e-6 {
+				t.Fatalf("test %d: top %v, expect %v", i, top[0].Data(), test.data)
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package layer
+
+import (
+	"context"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// neuron is embedded by the neuron layers, it holds the blob names of the
+// layer and applies an element-wise function to the bottom
+type neuron struct {
+	bottom []string
+	top    []string
+	name   string
+}
+
+func newNeuron(param *pb.LayerParameter) neuron {
+	return neuron{
+		bottom: param.GetBottom(),
+		top:    param.GetTop(),
+		name:   param.GetName(),
+	}
+}
+
+// forward returns the top holding f of every bottom value
+func (n *neuron) forward(ctx context.Context, bottom []*blob.Blob, f func(float64) float64) ([]*blob.Blob, error) {
+	top, err := newTop(ctx, bottom[0].Shape())
+	if err != nil {
+		return nil, err
+	}
+
+	data := top.Data()
+	for i, v := range bottom[0].Data() {
+		data[i] = f(v)
+	}
+
+	logForward(n.name, bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+func (n *neuron) Type() string {
+	return n.name
+}
+
+func (n *neuron) Bottom() []string {
+	return n.bottom
+}
+
+func (n *neuron) Top() []string {
+	return n.top
+}
@@ -0,0 +1,102 @@
+package layer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestNeuronLayers(t *testing.T) {
+	input := []float64{-2, -0.5, 0, 0.5, 2, 800}
+	tests := []struct {
+		types []string
+		param *pb.LayerParameter
+		f     func(float64) float64
+	}{
+		{[]string{"RELU", "ReLU"}, &pb.LayerParameter{}, func(x float64) float64 { return math.Max(x, 0) }},
+		{
+			[]string{"RELU", "ReLU"},
+			&pb.LayerParameter{ReluParam: &pb.ReLUParameter{NegativeSlope: proto.Float32(0.25)}},
+			func(x float64) float64 { return math.Max(x, 0) + 0.25*math.Min(x, 0) },
+		},
+		{[]string{"ABSVAL", "AbsVal"}, &pb.LayerParameter{}, math.Abs},
+		{[]string{"BNLL"}, &pb.LayerParameter{}, func(x float64) float64 {
+			if x > 100 {
+				return x
+			}
+			return math.Log(1 + math.Exp(x))
+		}},
+		{[]string{"SIGMOID", "Sigmoid"}, &pb.LayerParameter{}, func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }},
+		{[]string{"TANH", "TanH"}, &pb.LayerParameter{}, math.Tanh},
+		{[]string{"EXP", "Exp"}, &pb.LayerParameter{}, math.Exp},
+		{
+			[]string{"EXP", "Exp"},
+			&pb.LayerParameter{ExpParam: &pb.ExpParameter{Base: proto.Float32(2), Scale: proto.Float32(0.5), Shift: proto.Float32(1)}},
+			func(x float64) float64 { return math.Pow(2, 0.5*x+1) },
+		},
+		{
+			[]string{"Log"},
+			&pb.LayerParameter{LogParam: &pb.LogParameter{Base: proto.Float32(10), Scale: proto.Float32(2), Shift: proto.Float32(5)}},
+			func(x float64) float64 { return math.Log10(2*x + 5) },
+		},
+		{
+			[]string{"ELU"},
+			&pb.LayerParameter{EluParam: &pb.ELUParameter{Alpha: proto.Float32(0.5)}},
+			func(x float64) float64 {
+				if x > 0 {
+					return x
+				}
+				return 0.5 * (math.Exp(x) - 1)
+			},
+		},
+		{
+			[]string{"THRESHOLD", "Threshold"},
+			&pb.LayerParameter{ThresholdParam: &pb.ThresholdParameter{Threshold: proto.Float32(0.5)}},
+			func(x float64) float64 {
+				if x > 0.5 {
+					return 1
+				}
+				return 0
+			},
+		},
+		{
+			[]string{"POWER", "Power"},
+			&pb.LayerParameter{PowerParam: &pb.PowerParameter{Power: proto.Float32(2), Scale: proto.Float32(0.5), Shift: proto.Float32(1)}},
+			func(x float64) float64 { return math.Pow(0.5*x+1, 2) },
+		},
+	}
+
+	for _, test := range tests {
+		for _, tp := range test.types {
+			param := proto.Clone(test.param).(*pb.LayerParameter)
+			param.Name = proto.String("neuron")
+			param.Type = proto.String(tp)
+			l, err := LayerRegister.CreateLayer(param)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a bottom with less than the 4 legacy axes
+			bottom, err := blob.New([]int64{2, 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy(bottom.Data(), input)
+			top, err := l.Forward([]*blob.Blob{bottom})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, v := range top[0].Data() {
+				expect := test.f(input[i])
+				if math.Abs(v-expect) > 1e-6*math.Max(1, math.Abs(expect)) && !(math.IsInf(v, 1) && math.IsInf(expect, 1)) {
+					t.Fatalf("%s(%f) = %f, expect %f", tp, input[i], v, expect)
+				}
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package layer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -28,7 +29,7 @@ type PoolingLayer struct {
 }
 
 // NewPoolingLayer will construct a pooling layer from parameters
-func NewPoolingLayer(params *pb.V1LayerParameter) (Layer, error) {
+func NewPoolingLayer(params *pb.LayerParameter) (Layer, error) {
 	log.Println("construct pooling layer")
 
 	name := params.GetName()
@@ -43,10 +44,10 @@ func NewPoolingLayer(params *pb.V1LayerParameter) (Layer, error) {
 	if global && (kernelSize != 0 || kernelH != 0 || kernelW != 0) {
 		return nil, errors.New("With global pooling: true Filter size cannot specified")
 	}
-	if (kernelSize != 0) == ((kernelH != 0) && (kernelW != 0)) {
+	if !global && (kernelSize != 0) == ((kernelH != 0) && (kernelW != 0)) {
 		return nil, errors.New("Filter size is kernel_size OR kernel_h and kernel_w; not both")
 	}
-	if (kernelSize == 0) && (kernelH == 0 && kernelW == 0) {
+	if !global && (kernelSize == 0) && (kernelH == 0 && kernelW == 0) {
 		return nil, errors.New("For non-square filter both kernel_h and kernel_w are required")
 	}
 
@@ -98,36 +99,45 @@ func NewPoolingLayer(params *pb.V1LayerParameter) (Layer, error) {
 
 // Forward does forward pooling process
 func (pool *PoolingLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return pool.ForwardContext(context.Background(), bottom)
+}
+
+// ForwardContext checks the context for every image
+func (pool *PoolingLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
 	channels := bottom[0].Channels()
 	height := bottom[0].Height()
 	width := bottom[0].Width()
 
-	// reset global pooling parameters
+	// global pooling parameters depend on the bottom shape, keep them local
+	// so that the layer is never modified by Forward
+	kernelH, kernelW := pool.kernelH, pool.kernelW
+	padH, padW := pool.padH, pool.padW
+	strideH, strideW := pool.strideH, pool.strideW
 	if pool.global {
-		pool.kernelH = int(bottom[0].Height())
-		pool.kernelW = int(bottom[0].Width())
-		pool.padH = 0
-		pool.padW = 0
-		pool.strideH = 1
-		pool.strideW = 1
+		kernelH = int(bottom[0].Height())
+		kernelW = int(bottom[0].Width())
+		padH = 0
+		padW = 0
+		strideH = 1
+		strideW = 1
 	}
 
-	pooledHeight := int64(math.Floor(float64(int(height)+2*pool.padH-pool.kernelH)/float64(pool.strideH))) + 1
-	pooledWidth := int64(math.Floor(float64(int(width)+2*pool.padW-pool.kernelW)/float64(pool.strideW))) + 1
+	pooledHeight := int64(math.Floor(float64(int(height)+2*padH-kernelH)/float64(strideH))) + 1
+	pooledWidth := int64(math.Floor(float64(int(width)+2*padW-kernelW)/float64(strideW))) + 1
 
 	// if we have padding, ensure the last pooling starts strictly inside the
 	// image (instead of at the padding); otherwise clip the last.
-	if pool.padH > 0 || pool.padW > 0 {
-		if (pooledHeight-1)*int64(pool.strideH) >= height+int64(pool.padH) {
+	if padH > 0 || padW > 0 {
+		if (pooledHeight-1)*int64(strideH) >= height+int64(padH) {
 			pooledHeight--
 		}
-		if (pooledWidth-1)*int64(pool.strideW) >= width+int64(pool.padW) {
+		if (pooledWidth-1)*int64(strideW) >= width+int64(padW) {
 			pooledWidth--
 		}
 	}
 
 	shape := []int64{bottom[0].Num(), channels, pooledHeight, pooledWidth}
-	top, err := blob.New(shape)
+	top, err := newTop(ctx, shape)
 	if err != nil {
 		return nil, fmt.Errorf("%+v %s", shape, err)
 	}
@@ -135,18 +145,21 @@ func (pool *PoolingLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 	switch pool.poolType {
 	case pb.PoolingParameter_MAX:
 		for n := 0; n < int(bottom[0].Num()); n++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
 			for c := 0; c < int(channels); c++ {
 				for ph := 0; ph < int(pooledHeight); ph++ {
 					for pw := 0; pw < int(pooledWidth); pw++ {
-						hStart := ph*pool.strideH - pool.padH
-						wStart := pw*pool.strideW - pool.padW
+						hStart := ph*strideH - padH
+						wStart := pw*strideW - padW
 						hEnd := int(height)
-						if hStart+pool.kernelH < int(height) {
-							hEnd = hStart + pool.kernelH
+						if hStart+kernelH < int(height) {
+							hEnd = hStart + kernelH
 						}
 						wEnd := int(width)
-						if wStart+pool.kernelW < int(width) {
-							wEnd = wStart + pool.kernelW
+						if wStart+kernelW < int(width) {
+							wEnd = wStart + kernelW
 						}
 						if hStart < 0 {
 							hStart = 0
@@ -154,17 +167,15 @@ func (pool *PoolingLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 						if wStart < 0 {
 							wStart = 0
 						}
-						poolIndices := []int{n, c, ph, pw}
+						maxValue := -math.MaxFloat64
 						for h := hStart; h < hEnd; h++ {
 							for w := wStart; w < wEnd; w++ {
-								indices := []int{n, c, h, w}
-								bData := bottom[0].Get(indices)
-								tData := top.Get(poolIndices)
-								if bData > tData {
-									top.Set(poolIndices, bData)
+								if v := bottom[0].Get([]int{n, c, h, w}); v > maxValue {
+									maxValue = v
 								}
 							}
 						}
+						top.Set([]int{n, c, ph, pw}, maxValue)
 					}
 				}
 			}
@@ -172,35 +183,43 @@ func (pool *PoolingLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 
 	case pb.PoolingParameter_AVE:
 		for n := 0; n < int(bottom[0].Num()); n++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
 			for c := 0; c < int(channels); c++ {
 				for ph := 0; ph < int(pooledHeight); ph++ {
 					for pw := 0; pw < int(pooledWidth); pw++ {
-						hStart := ph*pool.strideH - pool.padH
-						wStart := pw*pool.strideW - pool.padW
-						hEnd := int(height)
-						if hStart+pool.kernelH < int(height) {
-							hEnd = hStart + pool.kernelH
+						hStart := ph*strideH - padH
+						wStart := pw*strideW - padW
+						// the pool size counts the padding, as Caffe does
+						hEnd := hStart + kernelH
+						if hEnd > int(height)+padH {
+							hEnd = int(height) + padH
 						}
-						wEnd := int(width)
-						if wStart+pool.kernelW < int(width) {
-							wEnd = wStart + pool.kernelW
+						wEnd := wStart + kernelW
+						if wEnd > int(width)+padW {
+							wEnd = int(width) + padW
 						}
+						poolSize := (hEnd - hStart) * (wEnd - wStart)
 						if hStart < 0 {
 							hStart = 0
 						}
 						if wStart < 0 {
 							wStart = 0
 						}
-						poolSize := (hEnd - hStart) * (wEnd - wStart)
-						poolIndices := []int{n, c, ph, pw}
+						if hEnd > int(height) {
+							hEnd = int(height)
+						}
+						if wEnd > int(width) {
+							wEnd = int(width)
+						}
+						var sum float64
 						for h := hStart; h < hEnd; h++ {
 							for w := wStart; w < wEnd; w++ {
-								indices := []int{n, c, h, w}
-								top.Set(poolIndices, bottom[0].Get(indices))
+								sum += bottom[0].Get([]int{n, c, h, w})
 							}
 						}
-						tData := top.Get(poolIndices)
-						top.Set(poolIndices, tData/float64(poolSize))
+						top.Set([]int{n, c, ph, pw}, sum/float64(poolSize))
 					}
 				}
 			}
@@ -210,7 +229,7 @@ func (pool *PoolingLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 		return nil, errors.New("stochastic pooling not implemented")
 	}
 
-	log.Println(pool.Type(), bottom[0].Shape(), "->", top.Shape())
+	logForward(pool.Type(), bottom[0], top)
 
 	return []*blob.Blob{top}, nil
 }
@@ -0,0 +1,58 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestPoolingLayer(t *testing.T) {
+	// a 3 x 3 image of negative values, pooled by 2 x 2 windows with stride 1
+	// and pad 1 into 4 x 4
+	tests := []struct {
+		pool *pb.PoolingParameter_PoolMethod
+		data []float64
+	}{
+		{
+			pb.PoolingParameter_MAX.Enum(),
+			[]float64{-9, -8, -7, -7, -6, -5, -4, -4, -3, -2, -1, -1, -3, -2, -1, -1},
+		},
+		{
+			// the padding counts in the pool size
+			pb.PoolingParameter_AVE.Enum(),
+			[]float64{
+				-2.25, -4.25, -3.75, -1.75,
+				-3.75, -7, -6, -2.75,
+				-2.25, -4, -3, -1.25,
+				-0.75, -1.25, -0.75, -0.25,
+			},
+		},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name: proto.String("pool"),
+			Type: proto.String("Pooling"),
+			PoolingParam: &pb.PoolingParameter{
+				Pool:       test.pool,
+				KernelSize: proto.Uint32(2),
+				Stride:     proto.Uint32(1),
+				Pad:        proto.Uint32(1),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		top, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 1, 3, 3}, -9)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Errorf("test %d: data %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
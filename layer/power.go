@@ -1,7 +1,6 @@
 package layer
 
 import (
-	"errors"
 	"math"
 
 	"github.com/cvley/gocaffe/blob"
@@ -11,23 +10,21 @@ import (
 // PowerLayer computes y = (\alpha x + \beta) ^ \gamma as specified by the
 // scale \alpha, shift \beta, and power \gamma
 type PowerLayer struct {
+	neuron
 	power     float64
 	scale     float64
 	shift     float64
 	diffScale float64
 }
 
-func NewPowerLayer(param *pb.V1LayerParameter) (*PowerLayer, error) {
+func NewPowerLayer(param *pb.LayerParameter) (*PowerLayer, error) {
 	powerParam := param.GetPowerParam()
-	if powerParam == nil {
-		return nil, errors.New("no power param")
-	}
-
 	power := float64(powerParam.GetPower())
 	scale := float64(powerParam.GetScale())
 	shift := float64(powerParam.GetShift())
 
 	return &PowerLayer{
+		neuron:    newNeuron(param),
 		power:     power,
 		scale:     scale,
 		shift:     shift,
@@ -64,7 +61,3 @@ func (p *PowerLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 
 	return []*blob.Blob{top}, nil
 }
-
-func (p *PowerLayer) String() string {
-	return "PowerLayer"
-}
@@ -0,0 +1,140 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// defaultPReLUFiller is the filler of slopes without filler, as in
+// prelu_layer.cpp
+var defaultPReLUFiller = &pb.FillerParameter{
+	Type:  proto.String("constant"),
+	Value: proto.Float32(0.25),
+}
+
+// PReLULayer represents Parametric Rectified Linear Unit non-linearity
+// y = \max(0, x) + a_c \min(0, x), with a learned slope a_c for every channel,
+// or one slope shared by all channels with channel_shared
+type PReLULayer struct {
+	channelShared bool
+	filler        *pb.FillerParameter
+	slope         *blob.Blob
+	bottom        []string
+	top           []string
+	name          string
+}
+
+func NewPReLULayer(param *pb.LayerParameter) (*PReLULayer, error) {
+	preluParam := param.GetPreluParam()
+	filler := preluParam.GetFiller()
+	if filler == nil {
+		filler = defaultPReLUFiller
+	}
+
+	prelu := &PReLULayer{
+		channelShared: preluParam.GetChannelShared(),
+		filler:        filler,
+		bottom:        param.GetBottom(),
+		top:           param.GetTop(),
+		name:          param.GetName(),
+	}
+
+	if len(param.GetBlobs()) > 0 {
+		slope, err := blob.FromProto(param.GetBlobs()[0])
+		if err != nil {
+			return nil, err
+		}
+		if prelu.channelShared && slope.Capacity() != 1 {
+			return nil, fmt.Errorf("create prelu layer %s fail, %d slopes shared by all channels", param.GetName(), slope.Capacity())
+		}
+		prelu.slope = slope
+	}
+
+	return prelu, nil
+}
+
+func (prelu *PReLULayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return prelu.ForwardContext(context.Background(), bottom)
+}
+
+func (prelu *PReLULayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	if prelu.slope == nil {
+		return nil, fmt.Errorf("prelu layer %s: no slopes, copy the trained layers or init the blobs first", prelu.name)
+	}
+
+	channels := preluChannels(bottom[0])
+	if !prelu.channelShared && int(prelu.slope.Capacity()) != channels {
+		return nil, fmt.Errorf("prelu layer %s: %d slopes for bottom shape %v with %d channels", prelu.name, prelu.slope.Capacity(), bottom[0].Shape(), channels)
+	}
+
+	top, err := newTop(ctx, bottom[0].Shape())
+	if err != nil {
+		return nil, err
+	}
+
+	dim := 1
+	if bottom[0].AxesNum() > 2 {
+		dim = int(bottom[0].CountRange(2, bottom[0].AxesNum()))
+	}
+	src := bottom[0].Data()
+	data := top.Data()
+	slopes := prelu.slope.Data()
+	for i, v := range src {
+		c := 0
+		if !prelu.channelShared {
+			c = (i / dim) % channels
+		}
+		data[i] = math.Max(v, 0) + slopes[c]*math.Min(v, 0)
+	}
+
+	logForward(prelu.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+// InitBlobs fills the slopes not loaded from a trained model with the filler,
+// constant 0.25 by default
+func (prelu *PReLULayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	if prelu.slope == nil {
+		shape := []int64{int64(preluChannels(bottom[0]))}
+		if prelu.channelShared {
+			shape = []int64{1}
+		}
+		slope, err := newFilledBlob(shape, prelu.filler, rng)
+		if err != nil {
+			return nil, err
+		}
+		prelu.slope = slope
+	}
+
+	return []*blob.Blob{prelu.slope}, nil
+}
+
+func (prelu *PReLULayer) Type() string {
+	return prelu.name
+}
+
+func (prelu *PReLULayer) Bottom() []string {
+	return prelu.bottom
+}
+
+func (prelu *PReLULayer) Top() []string {
+	return prelu.top
+}
+
+// preluChannels returns the number of channels of the bottom, 1 for blobs
+// with less than 2 axes
+func preluChannels(bottom *blob.Blob) int {
+	if bottom.AxesNum() < 2 {
+		return 1
+	}
+
+	return int(bottom.ShapeOfIndex(1))
+}
@@ -0,0 +1,76 @@
+package layer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestPReLULayer(t *testing.T) {
+	l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name: proto.String("prelu"),
+		Type: proto.String("PReLU"),
+		Blobs: []*pb.BlobProto{
+			{Shape: &pb.BlobShape{Dim: []int64{2}}, Data: []float32{0.5, 2}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 2, 1, 2}, -3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []float64{-1.5, -1, -2, 0}; !equalData(top[0].Data(), expect) {
+		t.Fatalf("top %v, expect %v", top[0].Data(), expect)
+	}
+}
+
+func TestPReLULayerFiller(t *testing.T) {
+	tests := []struct {
+		param *pb.PReLUParameter
+		shape []int64
+		data  []float64
+	}{
+		{nil, []int64{2}, []float64{-0.75, -0.5, -0.25, 0}},
+		{&pb.PReLUParameter{ChannelShared: proto.Bool(true)}, []int64{1}, []float64{-0.75, -0.5, -0.25, 0}},
+		{
+			&pb.PReLUParameter{Filler: &pb.FillerParameter{Type: proto.String("constant"), Value: proto.Float32(0.1)}},
+			[]int64{2},
+			[]float64{-0.3, -0.2, -0.1, 0},
+		},
+	}
+
+	for i, test := range tests {
+		l, err := NewPReLULayer(&pb.LayerParameter{
+			Name:       proto.String("prelu"),
+			PreluParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bottom := rangeBlob(t, []int64{1, 2, 1, 2}, -3)
+		blobs, err := l.InitBlobs([]*blob.Blob{bottom}, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(blobs[0].Shape(), test.shape) {
+			t.Fatalf("test %d: slope shape %v, expect %v", i, blobs[0].Shape(), test.shape)
+		}
+
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, v := range top[0].Data() {
+			if d := v - test.data[j]; d > 1e-6 || d < -1e-6 {
+				t.Fatalf("test %d: top %v, expect %v", i, top[0].Data(), test.data)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// reduceOps maps the reduction operations of the layer parameters to the
+// blob reductions
+var reduceOps = map[pb.ReductionParameter_ReductionOp]blob.ReduceOp{
+	pb.ReductionParameter_SUM:   blob.ReduceSum,
+	pb.ReductionParameter_ASUM:  blob.ReduceAsum,
+	pb.ReductionParameter_SUMSQ: blob.ReduceSumSq,
+	pb.ReductionParameter_MEAN:  blob.ReduceMean,
+}
+
+// ReductionLayer reduces the bottom over all axes from axis onwards with one
+// of the SUM, ASUM, SUMSQ and MEAN operations, and scales the result by
+// coeff, as reduction_layer.cpp. The top keeps the axes before axis, so
+// reducing from axis 0 gives a scalar
+type ReductionLayer struct {
+	op     blob.ReduceOp
+	axis   int
+	coeff  float64
+	bottom []string
+	top    []string
+	name   string
+}
+
+func NewReductionLayer(param *pb.LayerParameter) (*ReductionLayer, error) {
+	reductionParam := param.GetReductionParam()
+	op, exist := reduceOps[reductionParam.GetOperation()]
+	if !exist {
+		return nil, fmt.Errorf("create reduction layer %s fail, unknown operation %s", param.GetName(), reductionParam.GetOperation())
+	}
+
+	return &ReductionLayer{
+		op:     op,
+		axis:   int(reductionParam.GetAxis()),
+		coeff:  float64(reductionParam.GetCoeff()),
+		bottom: param.GetBottom(),
+		top:    param.GetTop(),
+		name:   param.GetName(),
+	}, nil
+}
+
+func (reduction *ReductionLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return reduction.ForwardContext(context.Background(), bottom)
+}
+
+func (reduction *ReductionLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	axis, err := bottom[0].CanonicalAxisIndex(reduction.axis)
+	if err != nil {
+		return nil, fmt.Errorf("reduction layer %s: %s", reduction.name, err)
+	}
+
+	shape := make([]int64, axis)
+	copy(shape, bottom[0].Shape()[:axis])
+	top, err := newTop(ctx, shape)
+	if err != nil {
+		return nil, err
+	}
+	if err := bottom[0].ReduceInto(top, reduction.op, axis); err != nil {
+		return nil, fmt.Errorf("reduction layer %s: %s", reduction.name, err)
+	}
+	if reduction.coeff != 1 {
+		top.Scale(reduction.coeff)
+	}
+
+	logForward(reduction.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+func (reduction *ReductionLayer) Type() string {
+	return reduction.name
+}
+
+func (reduction *ReductionLayer) Bottom() []string {
+	return reduction.bottom
+}
+
+func (reduction *ReductionLayer) Top() []string {
+	return reduction.top
+}
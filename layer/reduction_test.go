@@ -0,0 +1,80 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestReductionLayer(t *testing.T) {
+	tests := []struct {
+		param *pb.ReductionParameter
+		start float64
+		shape []int64
+		data  []float64
+	}{
+		{
+			// defaults: sum of all values to a scalar
+			nil, 0, []int64{}, []float64{66},
+		},
+		{
+			&pb.ReductionParameter{Axis: proto.Int32(1)},
+			0, []int64{2}, []float64{15, 51},
+		},
+		{
+			&pb.ReductionParameter{Operation: pb.ReductionParameter_MEAN.Enum(), Axis: proto.Int32(-1)},
+			0, []int64{2, 3}, []float64{0.5, 2.5, 4.5, 6.5, 8.5, 10.5},
+		},
+		{
+			&pb.ReductionParameter{Operation: pb.ReductionParameter_ASUM.Enum(), Axis: proto.Int32(2)},
+			-6, []int64{2, 3}, []float64{11, 7, 3, 1, 5, 9},
+		},
+		{
+			&pb.ReductionParameter{Operation: pb.ReductionParameter_SUMSQ.Enum(), Axis: proto.Int32(1), Coeff: proto.Float32(0.5)},
+			0, []int64{2}, []float64{27.5, 225.5},
+		},
+		{
+			&pb.ReductionParameter{Operation: pb.ReductionParameter_MEAN.Enum(), Coeff: proto.Float32(2)},
+			0, []int64{}, []float64{11},
+		},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:           proto.String("reduction"),
+			Type:           proto.String("Reduction"),
+			ReductionParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		top, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{2, 3, 2}, test.start)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Errorf("test %d: shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Errorf("test %d: data %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
+
+func TestReductionLayerAxisOutOfRange(t *testing.T) {
+	l, err := NewReductionLayer(&pb.LayerParameter{
+		Name:           proto.String("reduction"),
+		ReductionParam: &pb.ReductionParameter{Axis: proto.Int32(3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{2, 3, 2}, 0)}); err == nil {
+		t.Error("expect error for axis out of range")
+	}
+}
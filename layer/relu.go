@@ -1,7 +1,7 @@
 package layer
 
 import (
-	"log"
+	"context"
 	"math"
 
 	"github.com/cvley/gocaffe/blob"
@@ -9,65 +9,26 @@ import (
 )
 
 // ReLULayer represents Rectified Linear Unit non-linearity y = \max(0, x). The
-// simple max is fast to compute
+// simple max is fast to compute. With negative_slope, negative values are
+// multiplied by the slope instead of set to 0
 type ReLULayer struct {
+	neuron
 	negative float64
-	bottom   []string
-	top      []string
-	name     string
 }
 
-func NewReLULayer(param *pb.V1LayerParameter) (Layer, error) {
-	reluParam := param.GetReluParam()
-	if reluParam == nil {
-		return &ReLULayer{
-			negative: 0,
-			bottom:   param.GetBottom(),
-			top:      param.GetTop(),
-			name:     param.GetName(),
-		}, nil
-	}
-	negative := reluParam.GetNegativeSlope()
+func NewReLULayer(param *pb.LayerParameter) (Layer, error) {
 	return &ReLULayer{
-		negative: float64(negative),
-		bottom:   param.GetBottom(),
-		top:      param.GetTop(),
-		name:     param.GetName(),
+		neuron:   newNeuron(param),
+		negative: float64(param.GetReluParam().GetNegativeSlope()),
 	}, nil
 }
 
 func (relu *ReLULayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
-	top, err := blob.New(bottom[0].Shape())
-	if err != nil {
-		return nil, err
-	}
-
-	for n := 0; n < int(bottom[0].Num()); n++ {
-		for c := 0; c < int(bottom[0].Channels()); c++ {
-			for h := 0; h < int(bottom[0].Height()); h++ {
-				for w := 0; w < int(bottom[0].Width()); w++ {
-					idx := []int{n, c, h, w}
-					value := bottom[0].Get(idx)
-					reluV := math.Max(value, 0) + relu.negative*math.Min(value, 0)
-					top.Set(idx, reluV)
-				}
-			}
-		}
-	}
-
-	log.Println(relu.Type(), bottom[0].Shape(), "->", top.Shape())
-
-	return []*blob.Blob{top}, nil
-}
-
-func (relu *ReLULayer) Type() string {
-	return relu.name
-}
-
-func (relu *ReLULayer) Bottom() []string {
-	return relu.bottom
+	return relu.ForwardContext(context.Background(), bottom)
 }
 
-func (relu *ReLULayer) Top() []string {
-	return relu.top
+func (relu *ReLULayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return relu.forward(ctx, bottom, func(x float64) float64 {
+		return math.Max(x, 0) + relu.negative*math.Min(x, 0)
+	})
 }
@@ -0,0 +1,146 @@
+package layer
+
+import (
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// ReshapeLayer changes the shape of the bottom without changing its data, as
+// reshape_layer.cpp. The axes from axis to axis + num_axes of the bottom are
+// replaced by the shape, where a 0 copies the bottom dimension at the same
+// position and a single -1 is inferred from the bottom count
+type ReshapeLayer struct {
+	shape        []int64
+	axis         int
+	numAxes      int
+	inferredAxis int
+	copyAxes     []int
+	bottom       []string
+	top          []string
+	name         string
+}
+
+func NewReshapeLayer(param *pb.LayerParameter) (*ReshapeLayer, error) {
+	reshapeParam := param.GetReshapeParam()
+	if reshapeParam.GetShape() == nil {
+		return nil, fmt.Errorf("create reshape layer %s fail, no shape", param.GetName())
+	}
+
+	shape := reshapeParam.GetShape().GetDim()
+	inferredAxis := -1
+	copyAxes := []int{}
+	for i, v := range shape {
+		switch {
+		case v == 0:
+			copyAxes = append(copyAxes, i)
+		case v == -1:
+			if inferredAxis >= 0 {
+				return nil, fmt.Errorf("create reshape layer %s fail, new shape contains multiple -1 dims", param.GetName())
+			}
+			inferredAxis = i
+		case v < -1:
+			return nil, fmt.Errorf("create reshape layer %s fail, invalid dim %d in new shape", param.GetName(), v)
+		}
+	}
+
+	numAxes := int(reshapeParam.GetNumAxes())
+	if numAxes < -1 {
+		return nil, fmt.Errorf("create reshape layer %s fail, num_axes must be >= 0, or -1 for all", param.GetName())
+	}
+
+	return &ReshapeLayer{
+		shape:        shape,
+		axis:         int(reshapeParam.GetAxis()),
+		numAxes:      numAxes,
+		inferredAxis: inferredAxis,
+		copyAxes:     copyAxes,
+		bottom:       param.GetBottom(),
+		top:          param.GetTop(),
+		name:         param.GetName(),
+	}, nil
+}
+
+func (reshape *ReshapeLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	shape, err := reshape.topShape(bottom[0])
+	if err != nil {
+		return nil, err
+	}
+
+	top, err := bottom[0].Reshape(shape)
+	if err != nil {
+		return nil, err
+	}
+
+	logForward(reshape.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+// topShape returns the new shape of the bottom
+func (reshape *ReshapeLayer) topShape(bottom *blob.Blob) ([]int64, error) {
+	// a negative axis counts from the end, -1 being after the last axis
+	startAxis := reshape.axis
+	if startAxis < 0 {
+		startAxis += bottom.AxesNum() + 1
+	}
+	if startAxis < 0 || startAxis > bottom.AxesNum() {
+		return nil, fmt.Errorf("reshape layer %s: axis %d out of range for %d-D bottom", reshape.name, reshape.axis, bottom.AxesNum())
+	}
+
+	endAxis := bottom.AxesNum()
+	if reshape.numAxes >= 0 {
+		endAxis = startAxis + reshape.numAxes
+	}
+	if endAxis > bottom.AxesNum() {
+		return nil, fmt.Errorf("reshape layer %s: axis %d + num_axes %d out of range for %d-D bottom", reshape.name, reshape.axis, reshape.numAxes, bottom.AxesNum())
+	}
+
+	shape := []int64{}
+	shape = append(shape, bottom.Shape()[:startAxis]...)
+	shape = append(shape, reshape.shape...)
+	shape = append(shape, bottom.Shape()[endAxis:]...)
+
+	for _, i := range reshape.copyAxes {
+		if startAxis+i >= bottom.AxesNum() {
+			return nil, fmt.Errorf("reshape layer %s: new shape dim %d copies a dim out of the %d-D bottom", reshape.name, i, bottom.AxesNum())
+		}
+		shape[startAxis+i] = bottom.ShapeOfIndex(startAxis + i)
+	}
+
+	if reshape.inferredAxis >= 0 {
+		explicit := int64(1)
+		for i, v := range shape {
+			if i != startAxis+reshape.inferredAxis {
+				explicit *= v
+			}
+		}
+		if explicit == 0 || bottom.Capacity()%explicit != 0 {
+			return nil, fmt.Errorf("reshape layer %s: bottom count %d not divisible by the product of the new shape %v", reshape.name, bottom.Capacity(), shape)
+		}
+		shape[startAxis+reshape.inferredAxis] = bottom.Capacity() / explicit
+	}
+
+	count := int64(1)
+	for _, v := range shape {
+		count *= v
+	}
+	if count != bottom.Capacity() {
+		return nil, fmt.Errorf("reshape layer %s: bottom shape %v cannot be reshaped to %v", reshape.name, bottom.Shape(), shape)
+	}
+
+	return shape, nil
+}
+
+func (reshape *ReshapeLayer) Type() string {
+	return reshape.name
+}
+
+func (reshape *ReshapeLayer) Bottom() []string {
+	return reshape.bottom
+}
+
+func (reshape *ReshapeLayer) Top() []string {
+	return reshape.top
+}
@@ -0,0 +1,65 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestReshapeLayer(t *testing.T) {
+	tests := []struct {
+		param *pb.ReshapeParameter
+		shape []int64
+	}{
+		{&pb.ReshapeParameter{Shape: &pb.BlobShape{Dim: []int64{0, -1}}}, []int64{2, 60}},
+		{&pb.ReshapeParameter{Shape: &pb.BlobShape{Dim: []int64{3, 2, 0, 5}}}, []int64{3, 2, 4, 5}},
+		{&pb.ReshapeParameter{Shape: &pb.BlobShape{Dim: []int64{2, 2}}, Axis: proto.Int32(2), NumAxes: proto.Int32(1)}, []int64{2, 3, 2, 2, 5}},
+		{&pb.ReshapeParameter{Shape: &pb.BlobShape{Dim: []int64{1}}, Axis: proto.Int32(-1)}, []int64{2, 3, 4, 5, 1}},
+		{&pb.ReshapeParameter{Shape: &pb.BlobShape{Dim: []int64{-1, 2}}, Axis: proto.Int32(1), NumAxes: proto.Int32(2)}, []int64{2, 6, 2, 5}},
+	}
+
+	bottom := rangeBlob(t, []int64{2, 3, 4, 5}, 0)
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:         proto.String("reshape"),
+			Type:         proto.String("Reshape"),
+			ReshapeParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatalf("test %d: %s", i, err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Fatalf("test %d: top shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), bottom.Data()) {
+			t.Fatalf("test %d: reshape changes the data", i)
+		}
+	}
+}
+
+func TestReshapeLayerInvalid(t *testing.T) {
+	if _, err := NewReshapeLayer(&pb.LayerParameter{
+		Name:         proto.String("reshape"),
+		ReshapeParam: &pb.ReshapeParameter{Shape: &pb.BlobShape{Dim: []int64{-1, -1}}},
+	}); err == nil {
+		t.Fatal("expect error for multiple -1 dims")
+	}
+
+	l, err := NewReshapeLayer(&pb.LayerParameter{
+		Name:         proto.String("reshape"),
+		ReshapeParam: &pb.ReshapeParameter{Shape: &pb.BlobShape{Dim: []int64{7, -1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{2, 3, 4, 5}, 0)}); err == nil {
+		t.Fatal("expect error for count 120 not divisible by 7")
+	}
+}
@@ -0,0 +1,181 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// defaultScaleFiller is used for learned scales without filler, so that the
+// layer starts as the identity
+var defaultScaleFiller = &pb.FillerParameter{
+	Type:  proto.String("constant"),
+	Value: proto.Float32(1),
+}
+
+// ScaleLayer multiplies the bottom by a scale broadcast along the bottom axes
+// from axis, and adds a bias of the same shape with bias_term, as
+// scale_layer.cpp. The scale is either the second bottom or a learned blob
+// whose shape spans num_axes axes of the bottom
+type ScaleLayer struct {
+	axis       int
+	numAxes    int
+	biasTerm   bool
+	filler     *pb.FillerParameter
+	biasFiller *pb.FillerParameter
+	scale      *blob.Blob
+	bias       *blob.Blob
+	bottom     []string
+	top        []string
+	name       string
+}
+
+func NewScaleLayer(param *pb.LayerParameter) (*ScaleLayer, error) {
+	scaleParam := param.GetScaleParam()
+	if scaleParam.GetNumAxes() < -1 {
+		return nil, fmt.Errorf("create scale layer %s fail, num_axes must be >= 0, or -1 for all", param.GetName())
+	}
+
+	filler := scaleParam.GetFiller()
+	if filler == nil {
+		filler = defaultScaleFiller
+	}
+	scale := &ScaleLayer{
+		axis:       int(scaleParam.GetAxis()),
+		numAxes:    int(scaleParam.GetNumAxes()),
+		biasTerm:   scaleParam.GetBiasTerm(),
+		filler:     filler,
+		biasFiller: scaleParam.GetBiasFiller(),
+		bottom:     param.GetBottom(),
+		top:        param.GetTop(),
+		name:       param.GetName(),
+	}
+
+	// the learned scale comes first, then the bias
+	blobs := []*blob.Blob{}
+	for _, v := range param.GetBlobs() {
+		b, err := blob.FromProto(v)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, b)
+	}
+	if len(param.GetBottom()) == 1 && len(blobs) > 0 {
+		scale.scale = blobs[0]
+		blobs = blobs[1:]
+	}
+	if scale.biasTerm && len(blobs) > 0 {
+		scale.bias = blobs[0]
+	}
+
+	return scale, nil
+}
+
+func (scale *ScaleLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return scale.ForwardContext(context.Background(), bottom)
+}
+
+func (scale *ScaleLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	s := scale.scale
+	if len(bottom) > 1 {
+		s = bottom[1]
+	}
+	if s == nil || (scale.biasTerm && scale.bias == nil) {
+		return nil, fmt.Errorf("scale layer %s: no learned parameters, copy the trained layers or init the blobs first", scale.name)
+	}
+
+	// a scalar scale is broadcast from the first axis
+	axis := scale.axis
+	if s.AxesNum() == 0 {
+		axis = 0
+	}
+	outer, dim, inner, err := broadcastShape(bottom[0], s, axis)
+	if err != nil {
+		return nil, fmt.Errorf("scale layer %s: %s", scale.name, err)
+	}
+	if scale.biasTerm && scale.bias.Capacity() != int64(dim) {
+		return nil, fmt.Errorf("scale layer %s: bias shape %v mismatch scale shape %v", scale.name, scale.bias.Shape(), s.Shape())
+	}
+
+	top, err := newTop(ctx, bottom[0].Shape())
+	if err != nil {
+		return nil, err
+	}
+
+	src := bottom[0].Data()
+	data := top.Data()
+	factors := s.Data()
+	for n := 0; n < outer; n++ {
+		for d := 0; d < dim; d++ {
+			offset := (n*dim + d) * inner
+			for i := offset; i < offset+inner; i++ {
+				data[i] = src[i] * factors[d]
+			}
+		}
+	}
+	if scale.biasTerm {
+		addBias(data, data, scale.bias.Data(), outer, dim, inner)
+	}
+
+	logForward(scale.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+// InitBlobs fills the learned scale and bias not loaded from a trained model
+// with the filler, constant 1 by default, and the bias_filler, constant 0 by
+// default
+func (scale *ScaleLayer) InitBlobs(bottom []*blob.Blob, rng *rand.Rand) ([]*blob.Blob, error) {
+	var shape []int64
+	if len(scale.bottom) > 1 {
+		shape = bottom[1].Shape()
+	} else {
+		var err error
+		shape, err = paramShape(bottom[0], scale.axis, scale.numAxes)
+		if err != nil {
+			return nil, fmt.Errorf("scale layer %s: %s", scale.name, err)
+		}
+	}
+
+	blobs := []*blob.Blob{}
+	if len(scale.bottom) == 1 {
+		if scale.scale == nil {
+			s, err := newFilledBlob(shape, scale.filler, rng)
+			if err != nil {
+				return nil, err
+			}
+			scale.scale = s
+		}
+		blobs = append(blobs, scale.scale)
+	}
+
+	if scale.biasTerm {
+		if scale.bias == nil {
+			b, err := newFilledBlob(shape, scale.biasFiller, rng)
+			if err != nil {
+				return nil, err
+			}
+			scale.bias = b
+		}
+		blobs = append(blobs, scale.bias)
+	}
+
+	return blobs, nil
+}
+
+func (scale *ScaleLayer) Type() string {
+	return scale.name
+}
+
+func (scale *ScaleLayer) Bottom() []string {
+	return scale.bottom
+}
+
+func (scale *ScaleLayer) Top() []string {
+	return scale.top
+}
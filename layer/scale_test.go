@@ -0,0 +1,85 @@
+package layer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestScaleLayer(t *testing.T) {
+	// learned per-channel scale and bias on a 1 x 2 x 1 x 2 bottom
+	l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name:   proto.String("scale"),
+		Type:   proto.String("Scale"),
+		Bottom: []string{"data"},
+		Blobs: []*pb.BlobProto{
+			{Shape: &pb.BlobShape{Dim: []int64{2}}, Data: []float32{2, -1}},
+			{Shape: &pb.BlobShape{Dim: []int64{2}}, Data: []float32{0.5, 1}},
+		},
+		ScaleParam: &pb.ScaleParameter{BiasTerm: proto.Bool(true)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 2, 1, 2}, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []float64{0.5, 2.5, -1, -2}; !equalData(top[0].Data(), expect) {
+		t.Fatalf("top %v, expect %v", top[0].Data(), expect)
+	}
+
+	// second bottom spanning the channel and height axes
+	l, err = LayerRegister.CreateLayer(&pb.LayerParameter{
+		Name:   proto.String("scale"),
+		Type:   proto.String("Scale"),
+		Bottom: []string{"data", "factor"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err = l.Forward([]*blob.Blob{rangeBlob(t, []int64{2, 2, 1, 2}, 0), rangeBlob(t, []int64{2, 1}, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []float64{0, 1, 4, 6, 4, 5, 12, 14}; !equalData(top[0].Data(), expect) {
+		t.Fatalf("top %v, expect %v", top[0].Data(), expect)
+	}
+
+	if _, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{2, 2, 1, 2}, 0), rangeBlob(t, []int64{3}, 1)}); err == nil {
+		t.Fatal("expect error for scale shape mismatching the bottom")
+	}
+}
+
+func TestScaleLayerInitBlobs(t *testing.T) {
+	l, err := NewScaleLayer(&pb.LayerParameter{
+		Name:       proto.String("scale"),
+		Bottom:     []string{"data"},
+		ScaleParam: &pb.ScaleParameter{Axis: proto.Int32(-1), NumAxes: proto.Int32(-1), BiasTerm: proto.Bool(true)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bottom := rangeBlob(t, []int64{1, 2, 1, 3}, 0)
+	blobs, err := l.InitBlobs([]*blob.Blob{bottom}, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 2 || !equalShape(blobs[0].Shape(), []int64{3}) || !equalShape(blobs[1].Shape(), []int64{3}) {
+		t.Fatalf("init blobs %v, expect scale and bias of shape [3]", blobs)
+	}
+
+	// the default fillers make the layer the identity
+	top, err := l.Forward([]*blob.Blob{bottom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalData(top[0].Data(), bottom.Data()) {
+		t.Fatalf("top %v, expect %v", top[0].Data(), bottom.Data())
+	}
+}
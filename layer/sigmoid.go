@@ -1,6 +1,7 @@
 package layer
 
 import (
+	"context"
 	"math"
 
 	"github.com/cvley/gocaffe/blob"
@@ -12,50 +13,19 @@ import (
 // Note that the gradient vanishes as the values move away from 0.
 // The ReLULayer is often a better choice for this reason.
 type SigmoidLayer struct {
-	bottom []string
-	top    []string
-	name   string
+	neuron
 }
 
-func NewSigmoidLayer(param *pb.V1LayerParameter) (*SigmoidLayer, error) {
-	return &SigmoidLayer{
-		bottom: param.GetBottom(),
-		top:    param.GetTop(),
-		name:   param.GetName(),
-	}, nil
+func NewSigmoidLayer(param *pb.LayerParameter) (*SigmoidLayer, error) {
+	return &SigmoidLayer{neuron: newNeuron(param)}, nil
 }
 
 func (s *SigmoidLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
-	top, err := blob.New(bottom[0].Shape())
-	if err != nil {
-		return nil, err
-	}
-
-	for n := 0; n < int(bottom[0].Num()); n++ {
-		for c := 0; c < int(bottom[0].Channels()); c++ {
-			for h := 0; h < int(bottom[0].Height()); h++ {
-				for w := 0; w < int(bottom[0].Width()); w++ {
-					idx := []int{n, c, h, w}
-					v := bottom[0].Get(idx)
-					top.Set(idx, sigmoid(v))
-				}
-			}
-		}
-	}
-
-	return []*blob.Blob{top}, nil
-}
-
-func (s *SigmoidLayer) Type() string {
-	return s.name
-}
-
-func (s *SigmoidLayer) Bottom() []string {
-	return s.bottom
+	return s.ForwardContext(context.Background(), bottom)
 }
 
-func (s *SigmoidLayer) Top() []string {
-	return s.top
+func (s *SigmoidLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return s.forward(ctx, bottom, sigmoid)
 }
 
 func sigmoid(x float64) float64 {
@@ -0,0 +1,160 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// SliceLayer splits the bottom along the slice axis into one top per top
+// name, at the slice points or into equal parts when none is given
+type SliceLayer struct {
+	axis        int
+	legacyDim   bool
+	slicePoints []int64
+	bottom      []string
+	top         []string
+	name        string
+}
+
+func NewSliceLayer(param *pb.LayerParameter) (*SliceLayer, error) {
+	sliceParam := param.GetSliceParam()
+	if sliceParam == nil {
+		sliceParam = &pb.SliceParameter{}
+	}
+	if sliceParam.SliceDim != nil && sliceParam.Axis != nil {
+		return nil, fmt.Errorf("create slice layer %s fail, either axis or slice_dim should be specified", param.GetName())
+	}
+	if len(param.GetTop()) == 0 {
+		return nil, fmt.Errorf("create slice layer %s fail, no top", param.GetName())
+	}
+
+	// every slice point is after the previous one, the first after 0, so
+	// that no top is empty
+	slicePoints := make([]int64, len(sliceParam.GetSlicePoint()))
+	for i, v := range sliceParam.GetSlicePoint() {
+		if (i == 0 && v == 0) || (i > 0 && int64(v) <= slicePoints[i-1]) {
+			return nil, fmt.Errorf("create slice layer %s fail, slice points %v not increasing", param.GetName(), sliceParam.GetSlicePoint())
+		}
+		slicePoints[i] = int64(v)
+	}
+	if len(slicePoints) != 0 && len(slicePoints) != len(param.GetTop())-1 {
+		return nil, fmt.Errorf("create slice layer %s fail, %d slice points for %d tops", param.GetName(), len(slicePoints), len(param.GetTop()))
+	}
+
+	// the legacy slice_dim cannot count from the last axis
+	axis := int(sliceParam.GetAxis())
+	legacyDim := sliceParam.SliceDim != nil
+	if legacyDim {
+		axis = int(sliceParam.GetSliceDim())
+	}
+
+	return &SliceLayer{
+		axis:        axis,
+		legacyDim:   legacyDim,
+		slicePoints: slicePoints,
+		bottom:      param.GetBottom(),
+		top:         param.GetTop(),
+		name:        param.GetName(),
+	}, nil
+}
+
+func (slice *SliceLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return slice.ForwardContext(context.Background(), bottom)
+}
+
+// ForwardContext returns the bottom itself as a single top
+func (slice *SliceLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	axis, sizes, err := slice.sizes(bottom[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// a single top is the bottom itself
+	if len(sizes) == 1 {
+		return []*blob.Blob{bottom[0]}, nil
+	}
+
+	outer := int(bottom[0].CountRange(0, axis))
+	inner := int(bottom[0].CountRange(axis+1, bottom[0].AxesNum()))
+	bottomAxis := int(bottom[0].ShapeOfIndex(axis))
+	src := bottom[0].Data()
+
+	top := make([]*blob.Blob, len(sizes))
+	offset := 0
+	for i, size := range sizes {
+		shape := make([]int64, bottom[0].AxesNum())
+		copy(shape, bottom[0].Shape())
+		shape[axis] = size
+		t, err := newTop(ctx, shape)
+		if err != nil {
+			return nil, err
+		}
+
+		count := int(size) * inner
+		data := t.Data()
+		for n := 0; n < outer; n++ {
+			start := (n*bottomAxis + offset) * inner
+			copy(data[n*count:(n+1)*count], src[start:start+count])
+		}
+		offset += int(size)
+		top[i] = t
+	}
+
+	log.Println(slice.Type(), bottom[0].Shape(), "->", len(top), "tops")
+
+	return top, nil
+}
+
+// sizes returns the slice axis of the bottom and the size of every top along
+// it
+func (slice *SliceLayer) sizes(bottom *blob.Blob) (int, []int64, error) {
+	axis := slice.axis
+	if slice.legacyDim && axis < 0 {
+		return 0, nil, fmt.Errorf("slice layer %s: slice_dim %d should be >= 0", slice.name, axis)
+	}
+	axis, err := bottom.CanonicalAxisIndex(axis)
+	if err != nil {
+		return 0, nil, fmt.Errorf("slice layer %s: %s", slice.name, err)
+	}
+
+	dim := bottom.ShapeOfIndex(axis)
+	numTop := int64(len(slice.top))
+	sizes := make([]int64, 0, numTop)
+	if len(slice.slicePoints) == 0 {
+		if dim%numTop != 0 {
+			return 0, nil, fmt.Errorf("slice layer %s: bottom shape %v axis %d of size %d cannot be split equally into %d tops", slice.name, bottom.Shape(), axis, dim, numTop)
+		}
+		for i := int64(0); i < numTop; i++ {
+			sizes = append(sizes, dim/numTop)
+		}
+		return axis, sizes, nil
+	}
+
+	prev := int64(0)
+	for _, point := range slice.slicePoints {
+		if point >= dim {
+			return 0, nil, fmt.Errorf("slice layer %s: slice point %d out of bottom shape %v axis %d of size %d", slice.name, point, bottom.Shape(), axis, dim)
+		}
+		sizes = append(sizes, point-prev)
+		prev = point
+	}
+	sizes = append(sizes, dim-prev)
+
+	return axis, sizes, nil
+}
+
+func (slice *SliceLayer) Type() string {
+	return slice.name
+}
+
+func (slice *SliceLayer) Bottom() []string {
+	return slice.bottom
+}
+
+func (slice *SliceLayer) Top() []string {
+	return slice.top
+}
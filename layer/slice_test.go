@@ -0,0 +1,101 @@
+package layer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestSliceLayer(t *testing.T) {
+	tests := []struct {
+		param  *pb.SliceParameter
+		top    int
+		shapes [][]int64
+		data   [][]float64
+	}{
+		{
+			// equal split of the channel axis
+			param:  nil,
+			top:    2,
+			shapes: [][]int64{{2, 1, 1, 2}, {2, 1, 1, 2}},
+			data:   [][]float64{{0, 1, 4, 5}, {2, 3, 6, 7}},
+		},
+		{
+			param:  &pb.SliceParameter{Axis: proto.Int32(-1), SlicePoint: []uint32{1, 3}},
+			top:    3,
+			shapes: [][]int64{{2, 2, 1, 1}, {2, 2, 1, 2}, {2, 2, 1, 1}},
+			data:   [][]float64{{0, 4, 8, 12}, {1, 2, 5, 6, 9, 10, 13, 14}, {3, 7, 11, 15}},
+		},
+		{
+			param:  &pb.SliceParameter{SliceDim: proto.Uint32(0)},
+			top:    2,
+			shapes: [][]int64{{1, 2, 1, 2}, {1, 2, 1, 2}},
+			data:   [][]float64{{0, 1, 2, 3}, {4, 5, 6, 7}},
+		},
+	}
+
+	for i, test := range tests {
+		param := &pb.LayerParameter{
+			Name:       proto.String("slice"),
+			Type:       proto.String("Slice"),
+			Bottom:     []string{"data"},
+			SliceParam: test.param,
+		}
+		for j := 0; j < test.top; j++ {
+			param.Top = append(param.Top, "top")
+		}
+		shape := []int64{2, 2, 1, 2}
+		if test.param.GetAxis() == -1 {
+			shape = []int64{2, 2, 1, 4}
+		}
+
+		l, err := LayerRegister.CreateLayer(param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, err := l.Forward([]*blob.Blob{rangeBlob(t, shape, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(top) != test.top {
+			t.Fatalf("test %d: %d tops, expect %d", i, len(top), test.top)
+		}
+		for j := range top {
+			if !equalShape(top[j].Shape(), test.shapes[j]) {
+				t.Fatalf("test %d: top %d shape %v, expect %v", i, j, top[j].Shape(), test.shapes[j])
+			}
+			if !equalData(top[j].Data(), test.data[j]) {
+				t.Fatalf("test %d: top %d %v, expect %v", i, j, top[j].Data(), test.data[j])
+			}
+		}
+	}
+}
+
+func TestSliceLayerShapeError(t *testing.T) {
+	param := &pb.LayerParameter{
+		Name:   proto.String("slice1"),
+		Type:   proto.String("SLICE"),
+		Bottom: []string{"data"},
+		Top:    []string{"a", "b", "c"},
+	}
+	l, err := LayerRegister.CreateLayer(param)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 2, 3, 3}, 0)})
+	if err == nil || !strings.Contains(err.Error(), "slice1") {
+		t.Fatalf("expect error naming layer slice1 for 2 channels split into 3, got %v", err)
+	}
+
+	for _, points := range [][]uint32{{1}, {0, 1}, {2, 1}, {1, 1}} {
+		param.SliceParam = &pb.SliceParameter{SlicePoint: points}
+		if _, err := LayerRegister.CreateLayer(param); err == nil {
+			t.Fatalf("expect error for slice points %v with 3 tops", points)
+		}
+	}
+}
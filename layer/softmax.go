@@ -16,7 +16,7 @@ type SoftmaxLayer struct {
 	name   string
 }
 
-func NewSoftmaxLayer(param *pb.V1LayerParameter) (Layer, error) {
+func NewSoftmaxLayer(param *pb.LayerParameter) (Layer, error) {
 	softParam := param.GetSoftmaxParam()
 	axis := -1
 	if softParam != nil {
@@ -0,0 +1,146 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// SPPLayer implements the spatial pyramid pooling of spp_layer.cpp. Level i
+// of the pyramid pools every channel into 2^i x 2^i bins, and the flattened
+// levels are concatenated, so that the top is N x C*sum(4^i) whatever the
+// bottom size. A pyramid of height 1 pools into a N x C x 1 x 1 top
+type SPPLayer struct {
+	pyramidHeight int
+	poolType      pb.PoolingParameter_PoolMethod
+	bottom        []string
+	top           []string
+	name          string
+}
+
+func NewSPPLayer(param *pb.LayerParameter) (*SPPLayer, error) {
+	sppParam := param.GetSppParam()
+	if sppParam.GetPyramidHeight() == 0 {
+		return nil, fmt.Errorf("create spp layer %s fail, pyramid_height must be > 0", param.GetName())
+	}
+	if sppParam.GetPool() == pb.SPPParameter_STOCHASTIC {
+		return nil, fmt.Errorf("create spp layer %s fail, stochastic pooling not implemented", param.GetName())
+	}
+
+	return &SPPLayer{
+		pyramidHeight: int(sppParam.GetPyramidHeight()),
+		poolType:      pb.PoolingParameter_PoolMethod(sppParam.GetPool()),
+		bottom:        param.GetBottom(),
+		top:           param.GetTop(),
+		name:          param.GetName(),
+	}, nil
+}
+
+func (spp *SPPLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return spp.ForwardContext(context.Background(), bottom)
+}
+
+// ForwardContext pools every level with ctx, a pyramid of height 1 returns
+// the pooled top of its single level
+func (spp *SPPLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	if bottom[0].AxesNum() != 4 {
+		return nil, fmt.Errorf("spp layer %s: bottom shape %v, expect N x C x H x W", spp.name, bottom[0].Shape())
+	}
+
+	num := int(bottom[0].Num())
+	channels := int(bottom[0].Channels())
+	if spp.pyramidHeight == 1 {
+		pool, err := spp.poolingLayer(bottom[0], 0)
+		if err != nil {
+			return nil, fmt.Errorf("spp layer %s: %s", spp.name, err)
+		}
+		top, err := pool.ForwardContext(ctx, bottom)
+		if err != nil {
+			return nil, fmt.Errorf("spp layer %s: %s", spp.name, err)
+		}
+		logForward(spp.Type(), bottom[0], top[0])
+		return top, nil
+	}
+
+	// every level is flattened to N x C*bins*bins, the levels follow each
+	// other in every image
+	dim := 0
+	for level := 0; level < spp.pyramidHeight; level++ {
+		dim += channels << uint(2*level)
+	}
+	top, err := newTop(ctx, []int64{int64(num), int64(dim)})
+	if err != nil {
+		return nil, err
+	}
+
+	data := top.Data()
+	offset := 0
+	for level := 0; level < spp.pyramidHeight; level++ {
+		pool, err := spp.poolingLayer(bottom[0], level)
+		if err != nil {
+			return nil, fmt.Errorf("spp layer %s: %s", spp.name, err)
+		}
+		pooled, err := pool.ForwardContext(ctx, bottom)
+		if err != nil {
+			return nil, fmt.Errorf("spp layer %s: %s", spp.name, err)
+		}
+		bins := 1 << uint(level)
+		if pooled[0].Height() != int64(bins) || pooled[0].Width() != int64(bins) {
+			return nil, fmt.Errorf("spp layer %s: level %d pooled to shape %v, expect %d x %d bins", spp.name, level, pooled[0].Shape(), bins, bins)
+		}
+
+		levelDim := channels * bins * bins
+		src := pooled[0].Data()
+		for n := 0; n < num; n++ {
+			copy(data[n*dim+offset:n*dim+offset+levelDim], src[n*levelDim:(n+1)*levelDim])
+		}
+		offset += levelDim
+		blob.ReleaseContext(ctx, pooled[0])
+	}
+
+	logForward(spp.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+func (spp *SPPLayer) Type() string {
+	return spp.name
+}
+
+func (spp *SPPLayer) Bottom() []string {
+	return spp.bottom
+}
+
+func (spp *SPPLayer) Top() []string {
+	return spp.top
+}
+
+// poolingLayer returns the pooling of the pyramid level for the bottom, whose
+// kernel and stride cover the bottom with 2^level bins and whose padding
+// spreads the remainder on both sides. As in Caffe, the padding must be less
+// than the kernel, so the bottom must not be too small for the bins
+func (spp *SPPLayer) poolingLayer(bottom *blob.Blob, level int) (*PoolingLayer, error) {
+	bins := 1 << uint(level)
+	height := int(bottom.Height())
+	width := int(bottom.Width())
+	kernelH := (height + bins - 1) / bins
+	kernelW := (width + bins - 1) / bins
+	padH := (kernelH*bins - height + 1) / 2
+	padW := (kernelW*bins - width + 1) / 2
+	if padH >= kernelH || padW >= kernelW {
+		return nil, fmt.Errorf("bottom shape %v too small for %d x %d bins", bottom.Shape(), bins, bins)
+	}
+
+	return &PoolingLayer{
+		kernelH:  kernelH,
+		kernelW:  kernelW,
+		padH:     padH,
+		padW:     padW,
+		strideH:  kernelH,
+		strideW:  kernelW,
+		poolType: spp.poolType,
+		name:     fmt.Sprintf("%s_level%d", spp.name, level),
+	}, nil
+}
@@ -0,0 +1,106 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestSPPLayer(t *testing.T) {
+	// 2 equal images of 2 channels x 7 x 6, pooled into 1 + 4 + 16 bins per
+	// channel, expected outputs computed as spp_layer.cpp
+	tests := []struct {
+		pool *pb.SPPParameter_PoolMethod
+		data []float64
+	}{
+		{
+			nil,
+			[]float64{
+				11, 11,
+				11, 10, 11, 9, 10, 11, 10, 11,
+				-11, 3, 10, 1, 8, 11, 9, -3, 0, 10, 5, 8, 11, 6, 9, 4,
+				7, -2, 5, -4, 3, 10, 8, 11, -5, 9, 0, 7, 10, 1, 11, -1,
+			},
+		},
+		{
+			pb.SPPParameter_AVE.Enum(),
+			[]float64{
+				-0.023809523809523808, -0.09523809523809523,
+				-0.25, 0.16666666666666666, 1.0, -1.0, -0.16666666666666666, 0.25, -0.16666666666666666, -0.25,
+				-2.75, -0.25, 1.0, 0.25, 3.0, -0.75, 1.75, -2.5, -1.0, 2.75, -0.5, -0.75, 0.75, 0.5, -2.75, 1.0,
+				1.75, -2.75, -1.5, -1.0, 0.5, 0.0, 2.5, 0.75, -3.5, 3.5, -5.5, 2.5, 4.0, -4.5, 3.75, -1.5,
+			},
+		},
+	}
+
+	bottom, err := blob.New([]int64{2, 2, 7, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bottom.Data()
+	for i := range data {
+		data[i] = float64((i%84)*7%23 - 11)
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:     proto.String("spp"),
+			Type:     proto.String("SPP"),
+			SppParam: &pb.SPPParameter{PyramidHeight: proto.Uint32(3), Pool: test.pool},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		top, err := l.Forward([]*blob.Blob{bottom})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []int64{2, 42}; !equalShape(top[0].Shape(), expect) {
+			t.Errorf("test %d: shape %v, expect %v", i, top[0].Shape(), expect)
+		}
+		expect := append(append([]float64{}, test.data...), test.data...)
+		if !equalData(top[0].Data(), expect) {
+			t.Errorf("test %d: data %v, expect %v", i, top[0].Data(), expect)
+		}
+	}
+}
+
+func TestSPPLayerSingleLevel(t *testing.T) {
+	l, err := NewSPPLayer(&pb.LayerParameter{
+		Name:     proto.String("spp"),
+		SppParam: &pb.SPPParameter{PyramidHeight: proto.Uint32(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 2, 3, 2}, -20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []int64{1, 2, 1, 1}; !equalShape(top[0].Shape(), expect) {
+		t.Errorf("shape %v, expect %v", top[0].Shape(), expect)
+	}
+	if expect := []float64{-15, -9}; !equalData(top[0].Data(), expect) {
+		t.Errorf("data %v, expect %v", top[0].Data(), expect)
+	}
+}
+
+func TestSPPLayerBottomTooSmall(t *testing.T) {
+	l, err := NewSPPLayer(&pb.LayerParameter{
+		Name:     proto.String("spp"),
+		SppParam: &pb.SPPParameter{PyramidHeight: proto.Uint32(3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 bins over 5 rows need a padding of 2 for a kernel of 2
+	if _, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{1, 1, 5, 4}, 0)}); err == nil {
+		t.Error("expect error for bottom too small for the bins")
+	}
+}
@@ -0,0 +1,35 @@
+package layer
+
+import (
+	"context"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// ThresholdLayer tests whether the input exceeds a threshold, y = 1 for
+// x > threshold and y = 0 otherwise
+type ThresholdLayer struct {
+	neuron
+	threshold float64
+}
+
+func NewThresholdLayer(param *pb.LayerParameter) (*ThresholdLayer, error) {
+	return &ThresholdLayer{
+		neuron:    newNeuron(param),
+		threshold: float64(param.GetThresholdParam().GetThreshold()),
+	}, nil
+}
+
+func (th *ThresholdLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return th.ForwardContext(context.Background(), bottom)
+}
+
+func (th *ThresholdLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return th.forward(ctx, bottom, func(x float64) float64 {
+		if x > th.threshold {
+			return 1
+		}
+		return 0
+	})
+}
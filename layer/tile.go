@@ -0,0 +1,84 @@
+package layer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// TileLayer copies the bottom tiles times along axis, as tile_layer.cpp. The
+// block of axes from axis onwards is repeated, so tiling a N x C blob along
+// axis 1 gives N x tiles*C with every row repeated as a whole
+type TileLayer struct {
+	axis   int
+	tiles  int
+	bottom []string
+	top    []string
+	name   string
+}
+
+func NewTileLayer(param *pb.LayerParameter) (*TileLayer, error) {
+	tileParam := param.GetTileParam()
+	if tileParam == nil || tileParam.Tiles == nil {
+		return nil, fmt.Errorf("create tile layer %s fail, tiles must be set", param.GetName())
+	}
+	if tileParam.GetTiles() < 1 {
+		return nil, fmt.Errorf("create tile layer %s fail, tiles must be > 0", param.GetName())
+	}
+
+	return &TileLayer{
+		axis:   int(tileParam.GetAxis()),
+		tiles:  int(tileParam.GetTiles()),
+		bottom: param.GetBottom(),
+		top:    param.GetTop(),
+		name:   param.GetName(),
+	}, nil
+}
+
+func (tile *TileLayer) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return tile.ForwardContext(context.Background(), bottom)
+}
+
+func (tile *TileLayer) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	axis, err := bottom[0].CanonicalAxisIndex(tile.axis)
+	if err != nil {
+		return nil, fmt.Errorf("tile layer %s: %s", tile.name, err)
+	}
+
+	shape := make([]int64, bottom[0].AxesNum())
+	copy(shape, bottom[0].Shape())
+	shape[axis] *= int64(tile.tiles)
+	top, err := newTop(ctx, shape)
+	if err != nil {
+		return nil, err
+	}
+
+	outer := int(bottom[0].CountRange(0, axis))
+	inner := int(bottom[0].CountRange(axis, bottom[0].AxesNum()))
+	src := bottom[0].Data()
+	data := top.Data()
+	for i := 0; i < outer; i++ {
+		block := src[i*inner : (i+1)*inner]
+		for t := 0; t < tile.tiles; t++ {
+			copy(data[(i*tile.tiles+t)*inner:], block)
+		}
+	}
+
+	logForward(tile.Type(), bottom[0], top)
+
+	return []*blob.Blob{top}, nil
+}
+
+func (tile *TileLayer) Type() string {
+	return tile.name
+}
+
+func (tile *TileLayer) Bottom() []string {
+	return tile.bottom
+}
+
+func (tile *TileLayer) Top() []string {
+	return tile.top
+}
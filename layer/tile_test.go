@@ -0,0 +1,69 @@
+package layer
+
+import (
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+func TestTileLayer(t *testing.T) {
+	tests := []struct {
+		param *pb.TileParameter
+		shape []int64
+		data  []float64
+	}{
+		{
+			// default axis 1 repeats every image
+			&pb.TileParameter{Tiles: proto.Int32(2)},
+			[]int64{2, 4, 2},
+			[]float64{0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 6, 7, 4, 5, 6, 7},
+		},
+		{
+			&pb.TileParameter{Axis: proto.Int32(-1), Tiles: proto.Int32(3)},
+			[]int64{2, 2, 6},
+			[]float64{0, 1, 0, 1, 0, 1, 2, 3, 2, 3, 2, 3, 4, 5, 4, 5, 4, 5, 6, 7, 6, 7, 6, 7},
+		},
+		{
+			&pb.TileParameter{Axis: proto.Int32(0), Tiles: proto.Int32(2)},
+			[]int64{4, 2, 2},
+			[]float64{0, 1, 2, 3, 4, 5, 6, 7, 0, 1, 2, 3, 4, 5, 6, 7},
+		},
+	}
+
+	for i, test := range tests {
+		l, err := LayerRegister.CreateLayer(&pb.LayerParameter{
+			Name:      proto.String("tile"),
+			Type:      proto.String("Tile"),
+			TileParam: test.param,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		top, err := l.Forward([]*blob.Blob{rangeBlob(t, []int64{2, 2, 2}, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalShape(top[0].Shape(), test.shape) {
+			t.Errorf("test %d: shape %v, expect %v", i, top[0].Shape(), test.shape)
+		}
+		if !equalData(top[0].Data(), test.data) {
+			t.Errorf("test %d: data %v, expect %v", i, top[0].Data(), test.data)
+		}
+	}
+}
+
+func TestTileLayerInvalidParam(t *testing.T) {
+	for _, param := range []*pb.TileParameter{
+		nil,
+		{Axis: proto.Int32(1)},
+		{Tiles: proto.Int32(0)},
+	} {
+		if _, err := NewTileLayer(&pb.LayerParameter{Name: proto.String("tile"), TileParam: param}); err == nil {
+			t.Errorf("expect error for tile param %v", param)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package net
+
+import (
+	"github.com/cvley/gocaffe/blob"
+	"github.com/cvley/gocaffe/layer"
+)
+
+// Hook is a callback run around the Forward of every layer in the net. It
+// receives the layer with its bottom and top blobs; top is nil for hooks run
+// before Forward. A non-nil error aborts the forward pass and is returned,
+// wrapped with the layer name, by Forward.
+//
+// Hooks may be called from several goroutines when the net is shared, and
+// must not modify the blobs they receive.
+type Hook func(l layer.Layer, bottom, top []*blob.Blob) error
+
+// AddBeforeForward registers a hook run before each layer Forward, hooks run
+// in the order they were added. It must not be called while the net is
+// running Forward
+func (net *Net) AddBeforeForward(hook Hook) {
+	net.beforeHooks = append(net.beforeHooks, hook)
+}
+
+// AddAfterForward registers a hook run after each successful layer Forward,
+// hooks run in the order they were added. It must not be called while the net
+// is running Forward
+func (net *Net) AddAfterForward(hook Hook) {
+	net.afterHooks = append(net.afterHooks, hook)
+}
+
+func runHooks(hooks []Hook, l layer.Layer, bottom, top []*blob.Blob) error {
+	for _, hook := range hooks {
+		if err := hook(l, bottom, top); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
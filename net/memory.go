@@ -0,0 +1,184 @@
+package net
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/cvley/gocaffe/layer"
+)
+
+// bytesPerValue is the size of one blob value, blobs hold float64
+const bytesPerValue = 8
+
+// newPool returns the pool recycling the tops of one planned forward pass
+var newPool = blob.NewPool
+
+// Lifetime is the span of layers during which a blob is alive. A blob name
+// written by several layers, e.g. by in-place layers, has one lifetime for
+// every write
+type Lifetime struct {
+	// Name of the blob
+	Name string
+	// Def is the index of the layer writing the blob, -1 for net inputs
+	Def int
+	// LastUse is the index of the last layer reading the blob, -1 when it is
+	// never read, i.e. the blob is a net output
+	LastUse int
+	// Bytes is the size of the blob data, 0 when the layer returns its bottom
+	// as top and the blob shares the data of another one
+	Bytes int64
+}
+
+// MemoryPlan is the activation memory plan of a net, computed from the
+// lifetime of every blob in the layer graph. When a net has a memory plan,
+// Forward recycles the storage of a blob after its last reader for the tops
+// of later layers, so the memory held is bounded by PeakBytes instead of
+// TotalBytes.
+//
+// Only the tops allocated from the pool of the context, i.e. the tops of
+// layer.ContextLayer layers, are recycled, and the temporary buffers of the
+// layers, e.g. the im2col buffer of Convolution, are not counted. PeakBytes
+// assumes every top is pooled, it understates the memory held by nets with
+// other layers
+type MemoryPlan struct {
+	Lifetimes []Lifetime
+	// PeakBytes is the maximum size of the blobs alive at the same time
+	PeakBytes int64
+	// TotalBytes is the size of all blobs, the memory held without plan
+	TotalBytes int64
+
+	// dying lists for every layer the index of its bottoms whose lifetime
+	// ends with it
+	dying [][]int
+}
+
+func (plan *MemoryPlan) String() string {
+	return fmt.Sprintf("peak activation memory %d bytes, %d bytes without reuse", plan.PeakBytes, plan.TotalBytes)
+}
+
+// PlanMemory computes the lifetime of every blob in the net, and enables the
+// reuse of their storage in Forward. The bottom blobs are forwarded once to
+// measure the blob sizes reported in the plan. The plan is dropped when the
+// layers of the net change, e.g. by CopyTrainedLayersFromParam or Optimize.
+//
+// With a plan, the blobs given to hooks may be recycled once the net no
+// longer needs them, hooks must copy the blobs they keep. PlanMemory must
+// not run concurrently with Forward
+func (net *Net) PlanMemory(bottom []*blob.Blob) (*MemoryPlan, error) {
+	plan := &MemoryPlan{
+		Lifetimes: []Lifetime{},
+		dying:     make([][]int, len(net.layers)),
+	}
+
+	// current lifetime of each blob name, and the lifetimes written by each
+	// layer
+	current := make(map[string]int)
+	defs := make([][]int, len(net.layers))
+	for i, name := range net.inputNames() {
+		current[name] = len(plan.Lifetimes)
+		var size int64
+		if i < len(bottom) {
+			size = bottom[i].Capacity() * bytesPerValue
+		}
+		plan.Lifetimes = append(plan.Lifetimes, Lifetime{Name: name, Def: -1, LastUse: -1, Bytes: size})
+	}
+
+	reads := make([][]int, len(net.layers))
+	for i, l := range net.layers {
+		for _, name := range l.Bottom() {
+			idx, exist := current[name]
+			if !exist {
+				return nil, fmt.Errorf("plan memory: layer %s bottom %s not found", l.Type(), name)
+			}
+			plan.Lifetimes[idx].LastUse = i
+			reads[i] = append(reads[i], idx)
+		}
+		for _, name := range l.Top() {
+			current[name] = len(plan.Lifetimes)
+			defs[i] = append(defs[i], len(plan.Lifetimes))
+			plan.Lifetimes = append(plan.Lifetimes, Lifetime{Name: name, Def: i, LastUse: -1})
+		}
+	}
+
+	for i := range net.layers {
+		for k, idx := range reads[i] {
+			if plan.Lifetimes[idx].LastUse == i {
+				plan.dying[i] = append(plan.dying[i], k)
+			}
+		}
+	}
+
+	// measure the blob sizes, tops sharing the data of a bottom take no
+	// memory of their own
+	sizeHook := func(l layer.Layer, bottom, top []*blob.Blob) error {
+		i := net.index[l.Type()]
+		for k, idx := range defs[i] {
+			if k >= len(top) || shares(top[k], bottom) {
+				continue
+			}
+			plan.Lifetimes[idx].Bytes = top[k].Capacity() * bytesPerValue
+		}
+		return nil
+	}
+	net.plan = nil
+	if _, err := net.forward(context.Background(), bottom, len(net.layers), nil, []Hook{sizeHook}); err != nil {
+		return nil, err
+	}
+
+	// blobs never read live until the end of the forward pass
+	for step := -1; step < len(net.layers); step++ {
+		var live int64
+		for _, v := range plan.Lifetimes {
+			lastUse := v.LastUse
+			if lastUse < 0 {
+				lastUse = len(net.layers)
+			}
+			if v.Def <= step && step <= lastUse {
+				live += v.Bytes
+			}
+		}
+		if live > plan.PeakBytes {
+			plan.PeakBytes = live
+		}
+	}
+	for _, v := range plan.Lifetimes {
+		plan.TotalBytes += v.Bytes
+	}
+
+	net.plan = plan
+	return plan, nil
+}
+
+// release drops the bottoms of layer i whose lifetime ends from the blobs by
+// name, and gives them back to the pool unless they are still held under
+// another name
+func (plan *MemoryPlan) release(pool *blob.Pool, i int, names []string, bottom []*blob.Blob, blobs map[string]*blob.Blob) {
+	for _, k := range plan.dying[i] {
+		b := bottom[k]
+		if blobs[names[k]] == b {
+			delete(blobs, names[k])
+		}
+
+		held := false
+		for _, v := range blobs {
+			if v == b {
+				held = true
+				break
+			}
+		}
+		if !held {
+			pool.Release(b)
+		}
+	}
+}
+
+func shares(b *blob.Blob, list []*blob.Blob) bool {
+	for _, v := range list {
+		if v == b {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package net
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+)
+
+func TestPlanMemory(t *testing.T) {
+	net, input := newConcurrentNet(t)
+
+	expect, err := net.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := net.PlanMemory([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lifetimes := []Lifetime{
+		{Name: "data", Def: -1, LastUse: 0, Bytes: 144},
+		{Name: "conv1", Def: 0, LastUse: 1, Bytes: 144},
+		{Name: "conv1", Def: 1, LastUse: 2, Bytes: 144},
+		{Name: "pool1", Def: 2, LastUse: -1, Bytes: 16},
+	}
+	if len(plan.Lifetimes) != len(lifetimes) {
+		t.Fatalf("lifetimes %+v, expect %+v", plan.Lifetimes, lifetimes)
+	}
+	for i, v := range plan.Lifetimes {
+		if v != lifetimes[i] {
+			t.Fatalf("lifetimes %+v, expect %+v", plan.Lifetimes, lifetimes)
+		}
+	}
+	if plan.PeakBytes != 288 || plan.TotalBytes != 448 {
+		t.Fatalf("peak %d bytes, total %d bytes, expect 288 and 448", plan.PeakBytes, plan.TotalBytes)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			top, err := net.Forward([]*blob.Blob{input})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if top[0].DataString() != expect[0].DataString() {
+				t.Errorf("planned forward %s, expect %s", top[0].DataString(), expect[0].DataString())
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanMemoryReusesStorage(t *testing.T) {
+	net, input := newConcurrentNet(t)
+	plan, err := net.PlanMemory([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pool *blob.Pool
+	defer func(f func() *blob.Pool) { newPool = f }(newPool)
+	newPool = func() *blob.Pool {
+		pool = blob.NewPool()
+		return pool
+	}
+
+	if _, err := net.Forward([]*blob.Blob{input}); err != nil {
+		t.Fatal(err)
+	}
+	if pool == nil {
+		t.Fatal("planned forward allocates no pool")
+	}
+	// the pool allocates the conv1 top and its im2col buffer, the relu1 top
+	// reuses the buffer and the pool1 top reuses the released conv1 top
+	allocated := pool.Allocated() * bytesPerValue
+	if allocated >= plan.TotalBytes || allocated > plan.PeakBytes {
+		t.Fatalf("pool allocated %d bytes, expect at most the peak %d bytes", allocated, plan.PeakBytes)
+	}
+}
@@ -1,10 +1,12 @@
 package net
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 
 	"github.com/cvley/gocaffe/blob"
@@ -21,8 +23,20 @@ type Net struct {
 	input      []string
 	top        string
 	layers     []layer.Layer
+	params     []*pb.LayerParameter
 	layerNames []string
 	index      map[string]int
+	outputs    []string
+	plan       *MemoryPlan
+	graph      *graph
+	workers    int
+
+	// negative slopes of the ReLUs fused by Optimize, by layer name
+	fusedReLU map[string]float64
+	optimized bool
+
+	beforeHooks []Hook
+	afterHooks  []Hook
 }
 
 func New(text string) (*Net, error) {
@@ -31,9 +45,22 @@ func New(text string) (*Net, error) {
 		return nil, err
 	}
 
+	params := layerParams(param)
+	input := param.GetInput()
+
 	// extract input dim
 	inputDim := param.GetInputDim()
 	inputShape := param.GetInputShape()
+	if inputDim == nil && inputShape == nil {
+		// the current format declares the input with an Input layer
+		for _, v := range params {
+			if v.GetType() == "Input" && len(v.GetInputParam().GetShape()) > 0 {
+				inputShape = v.GetInputParam().GetShape()
+				input = v.GetTop()
+				break
+			}
+		}
+	}
 	if inputDim == nil && inputShape == nil {
 		return nil, errors.New("net prototxt don't have input dim")
 	}
@@ -48,38 +75,76 @@ func New(text string) (*Net, error) {
 		}
 	}
 
+	net := &Net{
+		Parameters: param,
+		name:       param.GetName(),
+		inputDim:   iDim,
+		input:      input,
+	}
+	if err := net.setLayers(params, nil); err != nil {
+		return nil, err
+	}
+
+	return net, nil
+}
+
+// setLayers creates the layers of the net from their parameters and fuses the
+// ReLUs with the negative slopes into the named layers. Layers that cannot be
+// created are skipped but their parameters are kept. The net is only changed
+// when all ReLUs are fused
+func (net *Net) setLayers(params []*pb.LayerParameter, fusedReLU map[string]float64) error {
 	layers := []layer.Layer{}
 	names := []string{}
 	index := make(map[string]int)
-	idx := 0
-	if param.GetLayer() != nil {
-		//TODO V0 layer support
-		return nil, errors.New("V0 layer not support")
+
+	for _, v := range params {
+		if v.GetType() == "Input" {
+			continue
+		}
+		l, err := layer.LayerRegister.CreateLayer(v)
+		if err != nil {
+			log.Println("ERROR create layer", v.GetName(), "fail", err)
+			continue
+		}
+		index[v.GetName()] = len(layers)
+		layers = append(layers, l)
+		names = append(names, v.GetName())
 	}
 
-	if param.GetLayers() != nil {
-		for _, v := range param.GetLayers() {
-			l, err := layer.LayerRegister.CreateLayer(v)
-			if err != nil {
-				log.Println("ERROR create layer", v.GetName(), "fail", err)
-				continue
-			}
-			layers = append(layers, l)
-			names = append(names, v.GetName())
-			index[v.GetName()] = idx
-			idx++
+	for name, negativeSlope := range fusedReLU {
+		idx, exist := index[name]
+		if !exist {
+			return fmt.Errorf("fuse relu: layer %s not created", name)
+		}
+		fuser, ok := layers[idx].(layer.ReLUFuser)
+		if !ok {
+			return fmt.Errorf("fuse relu: layer %s cannot fuse ReLU", name)
 		}
+		fuser.FuseReLU(negativeSlope)
 	}
 
-	return &Net{
-		Parameters: param,
-		name:       param.GetName(),
-		inputDim:   iDim,
-		input:      param.GetInput(),
-		layers:     layers,
-		layerNames: names,
-		index:      index,
-	}, nil
+	net.params = params
+	net.layers = layers
+	net.layerNames = names
+	net.index = index
+	net.fusedReLU = fusedReLU
+
+	// the outputs are the tops no later layer reads
+	net.outputs = []string{}
+	for _, l := range net.layers {
+		for _, name := range l.Bottom() {
+			net.outputs = remove(net.outputs, name)
+		}
+		for _, name := range l.Top() {
+			net.outputs = append(remove(net.outputs, name), name)
+		}
+	}
+
+	net.graph = newGraph(net.layers, net.inputNames(), net.outputs)
+
+	// a memory plan depends on the layers
+	net.plan = nil
+	return nil
 }
 
 func (net *Net) GetInputSize() (int64, int64) {
@@ -87,6 +152,13 @@ func (net *Net) GetInputSize() (int64, int64) {
 	return net.inputDim[2], net.inputDim[3]
 }
 
+// GetInputShape returns the shape of the net input blob
+func (net *Net) GetInputShape() []int64 {
+	shape := make([]int64, len(net.inputDim))
+	copy(shape, net.inputDim)
+	return shape
+}
+
 func (net *Net) CopyTrainedLayersFromFile(file string) error {
 	f, err := os.Open(file)
 	if err != nil {
@@ -106,58 +178,216 @@ func (net *Net) CopyTrainedLayersFromFile(file string) error {
 	return net.CopyTrainedLayersFromParam(param)
 }
 
+// CopyTrainedLayersFromParam copies the blobs of the trained layers to the
+// layers of the net with the same name, trained layers not in the net are
+// ignored. The trained layers must be copied before Optimize, whose folded
+// weights and fused layers they would not match
 func (net *Net) CopyTrainedLayersFromParam(param *pb.NetParameter) error {
-	for _, layerParam := range param.GetLayers() {
-		if layerParam.GetType().String() == "DATA" {
-			continue
-		}
-		l, err := layer.LayerRegister.CreateLayer(layerParam)
-		if err != nil {
-			return err
-		}
+	if net.optimized {
+		return errors.New("copy trained layers: the net is optimized, copy the trained layers before Optimize")
+	}
 
-		if len(l.Top()) == 0 {
+	params := make([]*pb.LayerParameter, len(net.params))
+	copy(params, net.params)
+	paramIndex := make(map[string]int)
+	for i, v := range params {
+		paramIndex[v.GetName()] = i
+	}
+
+	for _, trained := range layerParams(param) {
+		if len(trained.GetBlobs()) == 0 {
 			continue
 		}
 
-		log.Printf("%+v\n", l)
-		idx, exist := net.index[l.Type()]
+		idx, exist := paramIndex[trained.GetName()]
 		if !exist {
-			log.Println("ERROR not found name", l.Type(), "in net parameters")
+			log.Println("ERROR not found name", trained.GetName(), "in net parameters")
 			continue
 		}
-		net.layers[idx] = l
+
+		layerParam := proto.Clone(params[idx]).(*pb.LayerParameter)
+		layerParam.Blobs = trained.GetBlobs()
+		// the trained blobs must fit the layer they are copied to
+		if _, created := net.index[trained.GetName()]; created {
+			if _, err := layer.LayerRegister.CreateLayer(layerParam); err != nil {
+				return err
+			}
+		}
+		params[idx] = layerParam
 	}
 
+	if err := net.setLayers(params, net.fusedReLU); err != nil {
+		return err
+	}
 	net.Parameters = param
 	net.name = param.GetName()
 	return nil
 }
 
+// Forward runs all layers of the net on the input blobs. Layers keep no state
+// between calls, so Forward is safe for concurrent use by multiple goroutines
+// as long as the net is not being loaded with CopyTrainedLayersFromParam at
+// the same time
 func (net *Net) Forward(bottom []*blob.Blob) ([]*blob.Blob, error) {
 	return net.ForwardFromTo(bottom, len(net.layers))
 }
 
+// ForwardContext is Forward with cancellation: the context is checked before
+// every layer and inside long running layers. When ctx is done, the returned
+// error wraps ctx.Err() with the name of the layer that was running, so it
+// can be tested with errors.Is(err, context.DeadlineExceeded)
+func (net *Net) ForwardContext(ctx context.Context, bottom []*blob.Blob) ([]*blob.Blob, error) {
+	return net.ForwardFromToContext(ctx, bottom, len(net.layers))
+}
+
 func (net *Net) ForwardFromTo(bottom []*blob.Blob, end int) (top []*blob.Blob, err error) {
+	return net.ForwardFromToContext(context.Background(), bottom, end)
+}
+
+// ForwardFromToContext is ForwardFromTo with cancellation, see ForwardContext
+func (net *Net) ForwardFromToContext(ctx context.Context, bottom []*blob.Blob, end int) (top []*blob.Blob, err error) {
+	return net.forward(ctx, bottom, end, net.beforeHooks, net.afterHooks)
+}
+
+// InitBlobs fills the learnable blobs of layers which were not loaded from a
+// trained model, using the fillers in the layer parameters and a random
+// source seeded by seed. The bottom blobs are forwarded through the net to
+// find the shapes each layer sees, and the blobs are kept in the layer
+// parameters as if they were trained. InitBlobs modifies the layers, so it
+// must not run concurrently with Forward
+func (net *Net) InitBlobs(bottom []*blob.Blob, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	initHook := func(l layer.Layer, bottom, top []*blob.Blob) error {
+		init, ok := l.(layer.Initializer)
+		if !ok {
+			return nil
+		}
+		blobs, err := init.InitBlobs(bottom, rng)
+		if err != nil {
+			return err
+		}
+
+		for i, v := range net.params {
+			if v.GetName() != l.Type() {
+				continue
+			}
+			layerParam := proto.Clone(v).(*pb.LayerParameter)
+			layerParam.Blobs = make([]*pb.BlobProto, len(blobs))
+			for j, b := range blobs {
+				layerParam.Blobs[j] = blobProto(b)
+			}
+			net.params[i] = layerParam
+		}
+		return nil
+	}
+
+	_, err := net.forward(context.Background(), bottom, len(net.layers), []Hook{initHook}, nil)
+	return err
+}
+
+// forward runs the layers up to index end included, reading the bottoms of
+// each layer from the blobs produced so far by name. It returns the tops of
+// layer end, or the outputs of the net when end is past the last layer
+func (net *Net) forward(ctx context.Context, bottom []*blob.Blob, end int, beforeHooks, afterHooks []Hook) ([]*blob.Blob, error) {
+	if net.Workers() > 1 {
+		return net.forwardParallel(ctx, bottom, end, beforeHooks, afterHooks)
+	}
+
 	if !net.checkBottomShape(bottom[0]) {
 		return nil, fmt.Errorf("bottom shape %v mismatch net input dim %v", bottom[0].Shape(), net.inputDim)
 	}
 
+	blobs := make(map[string]*blob.Blob)
+	for i, name := range net.inputNames() {
+		if i < len(bottom) {
+			blobs[name] = bottom[i]
+		}
+	}
+
+	// with a memory plan, tops are allocated from a pool recycling the
+	// storage of blobs after their last reader
+	var pool *blob.Pool
+	if net.plan != nil {
+		pool = newPool()
+		ctx = blob.WithPool(ctx, pool)
+	}
+
 	for i, l := range net.layers {
-		log.Println("process", l.Type(), "from [", l.Bottom()[0], "] to [", l.Top()[0], "]", i)
-		top, err = l.Forward(bottom)
+		bottoms := make([]*blob.Blob, len(l.Bottom()))
+		for k, name := range l.Bottom() {
+			b, exist := blobs[name]
+			if !exist {
+				return nil, fmt.Errorf("layer forward %s: bottom %s not found", l.Type(), name)
+			}
+			bottoms[k] = b
+		}
+
+		top, err := net.forwardLayer(ctx, l, bottoms, beforeHooks, afterHooks)
 		if err != nil {
-			return nil, fmt.Errorf("layer forward %s %s %s", l.Type(), l.Bottom()[0], err)
+			return nil, err
+		}
+		if len(top) < len(l.Top()) {
+			return nil, fmt.Errorf("layer forward %s: %d tops, expect %d", l.Type(), len(top), len(l.Top()))
+		}
+		for k, name := range l.Top() {
+			blobs[name] = top[k]
+		}
+
+		if i == end {
+			return top, nil
+		}
+
+		if pool != nil {
+			net.plan.release(pool, i, l.Bottom(), bottoms, blobs)
 		}
-		if i >= end {
-			break
+	}
+
+	top := make([]*blob.Blob, len(net.outputs))
+	for i, name := range net.outputs {
+		top[i] = blobs[name]
+	}
+
+	return top, nil
+}
+
+// forwardLayer runs the forward of one layer with the hooks
+func (net *Net) forwardLayer(ctx context.Context, l layer.Layer, bottom []*blob.Blob, beforeHooks, afterHooks []Hook) (top []*blob.Blob, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("layer forward %s cancelled: %w", l.Type(), err)
+	}
+
+	log.Println("process", l.Type(), "from", l.Bottom(), "to", l.Top())
+	if err := runHooks(beforeHooks, l, bottom, nil); err != nil {
+		return nil, fmt.Errorf("layer forward %s aborted by hook: %w", l.Type(), err)
+	}
+	if cl, ok := l.(layer.ContextLayer); ok {
+		top, err = cl.ForwardContext(ctx, bottom)
+	} else {
+		top, err = l.Forward(bottom)
+	}
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return nil, fmt.Errorf("layer forward %s cancelled: %w", l.Type(), err)
 		}
-		bottom = top
+		return nil, fmt.Errorf("layer forward %s %v %s", l.Type(), l.Bottom(), err)
+	}
+	if err := runHooks(afterHooks, l, bottom, top); err != nil {
+		return nil, fmt.Errorf("layer forward %s aborted by hook: %w", l.Type(), err)
 	}
 
 	return top, nil
 }
 
+// inputNames returns the names of the net input blobs, nets without declared
+// input feed the bottoms of their first layer
+func (net *Net) inputNames() []string {
+	if len(net.input) == 0 && len(net.layers) > 0 {
+		return net.layers[0].Bottom()
+	}
+
+	return net.input
+}
+
 func (net *Net) checkBottomShape(bottom *blob.Blob) bool {
 	shape := bottom.Shape()
 	if len(shape) != len(net.inputDim) {
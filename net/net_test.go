@@ -1,9 +1,20 @@
 package net
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/cvley/gocaffe/layer"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
 )
 
 var (
@@ -37,3 +48,272 @@ func TestNet(t *testing.T) {
 	t.Logf("%+v\n", net)
 	t.Logf("%+v\n", net.Parameters)
 }
+
+const concurrentDeploy = `
+name: "concurrent"
+input: "data"
+input_dim: 1
+input_dim: 2
+input_dim: 3
+input_dim: 3
+layers {
+  name: "conv1"
+  type: CONVOLUTION
+  bottom: "data"
+  top: "conv1"
+  convolution_param {
+    num_output: 2
+    kernel_size: 1
+  }
+}
+layers {
+  name: "relu1"
+  type: RELU
+  bottom: "conv1"
+  top: "conv1"
+}
+layers {
+  name: "pool1"
+  type: POOLING
+  bottom: "conv1"
+  top: "pool1"
+  pooling_param {
+    pool: MAX
+    global_pooling: true
+  }
+}
+`
+
+func legacyBlobProto(num, channels, height, width int32, data []float32) *pb.BlobProto {
+	return &pb.BlobProto{
+		Num:      &num,
+		Channels: &channels,
+		Height:   &height,
+		Width:    &width,
+		Data:     data,
+	}
+}
+
+// newConcurrentNet returns the concurrentDeploy net with trained conv1
+// weights, and an input blob for it
+func newConcurrentNet(t *testing.T) (*Net, *blob.Blob) {
+	net, err := New(concurrentDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trained := &pb.NetParameter{}
+	if err := proto.UnmarshalText(concurrentDeploy, trained); err != nil {
+		t.Fatal(err)
+	}
+	trained.GetLayers()[0].Blobs = []*pb.BlobProto{
+		legacyBlobProto(2, 2, 1, 1, []float32{1, -1, 0.5, 2}),
+		legacyBlobProto(1, 1, 1, 2, []float32{0.1, -0.1}),
+	}
+	if err := net.CopyTrainedLayersFromParam(trained); err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := blob.New([]int64{1, 2, 3, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h := 0; h < 3; h++ {
+		for w := 0; w < 3; w++ {
+			input.Set([]int{0, 0, h, w}, float64(h*3+w))
+			input.Set([]int{0, 1, h, w}, float64(w-h))
+		}
+	}
+
+	return net, input
+}
+
+func TestForwardConcurrent(t *testing.T) {
+	net, input := newConcurrentNet(t)
+
+	expect, err := net.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				top, err := net.Forward([]*blob.Blob{input})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if top[0].DataString() != expect[0].DataString() {
+					errs <- fmt.Errorf("concurrent forward mismatch: %s, expect %s", top[0].DataString(), expect[0].DataString())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestForwardContextCancel(t *testing.T) {
+	net, input := newConcurrentNet(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := net.ForwardContext(ctx, []*blob.Blob{input})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context canceled error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "conv1") {
+		t.Fatalf("expect error naming layer conv1, got %v", err)
+	}
+
+	if _, err := net.ForwardContext(context.Background(), []*blob.Blob{input}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cancelAfterChecks is a context cancelled by the check following the given
+// number of checks of Err, once armed
+type cancelAfterChecks struct {
+	context.Context
+	cancel func()
+	armed  bool
+	checks int
+}
+
+func (c *cancelAfterChecks) Err() error {
+	if c.armed {
+		if c.checks == 0 {
+			c.cancel()
+		}
+		c.checks--
+	}
+	return c.Context.Err()
+}
+
+func TestForwardContextCancelInLayer(t *testing.T) {
+	deploy := `
+name: "cancel"
+input: "data"
+input_dim: 2
+input_dim: 2
+input_dim: 3
+input_dim: 3
+layer {
+  name: "conv1"
+  type: "Convolution"
+  bottom: "data"
+  top: "conv1"
+  convolution_param {
+    num_output: 2
+    kernel_size: 1
+    group: 2
+  }
+}
+layer {
+  name: "relu1"
+  type: "ReLU"
+  bottom: "conv1"
+  top: "conv1"
+}
+`
+	net, err := New(deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := blob.New([]int64{2, 2, 3, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.InitBlobs([]*blob.Blob{input}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the convolution checks the context before the first image and its
+	// first group, and is cancelled before its second group
+	ctx := &cancelAfterChecks{Context: parent, cancel: cancel, checks: 2}
+	var before, after []string
+	net.AddBeforeForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		before = append(before, l.Type())
+		if l.Type() == "conv1" {
+			ctx.armed = true
+		}
+		return nil
+	})
+	net.AddAfterForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		after = append(after, l.Type())
+		return nil
+	})
+
+	_, err = net.ForwardContext(ctx, []*blob.Blob{input})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context canceled error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "conv1") {
+		t.Fatalf("expect error naming layer conv1, got %v", err)
+	}
+	if ctx.checks >= 0 {
+		t.Fatalf("conv1 returned before checking the context %d more times", ctx.checks+1)
+	}
+	if len(before) != 1 || before[0] != "conv1" || len(after) != 0 {
+		t.Fatalf("layers run %v and finished %v, expect conv1 run and none finished", before, after)
+	}
+}
+
+func TestForwardHooks(t *testing.T) {
+	net, input := newConcurrentNet(t)
+
+	var before, after []string
+	activations := make(map[string]*blob.Blob)
+	net.AddBeforeForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		if top != nil {
+			return errors.New("before hook receives top blobs")
+		}
+		before = append(before, l.Type())
+		return nil
+	})
+	net.AddAfterForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		after = append(after, l.Type())
+		activations[l.Type()] = top[0]
+		return nil
+	})
+
+	tops, err := net.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"conv1", "relu1", "pool1"}
+	if strings.Join(before, ",") != strings.Join(expect, ",") {
+		t.Fatalf("before hooks run on %v, expect %v", before, expect)
+	}
+	if strings.Join(after, ",") != strings.Join(expect, ",") {
+		t.Fatalf("after hooks run on %v, expect %v", after, expect)
+	}
+	if activations["pool1"] != tops[0] {
+		t.Fatal("after hook does not receive the top blob of the layer")
+	}
+
+	errAbort := errors.New("abort")
+	net.AddBeforeForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		if l.Type() == "relu1" {
+			return errAbort
+		}
+		return nil
+	})
+	if _, err := net.Forward([]*blob.Blob{input}); !errors.Is(err, errAbort) {
+		t.Fatalf("expect forward aborted by hook, got %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// Change describes one rewrite made by Optimize
+type Change struct {
+	// Action is one of "remove", "fold" or "fuse"
+	Action string
+	// Layer is the layer removed, folded or fused
+	Layer string
+	// Into is the layer that Layer was folded or fused into, empty when the
+	// layer is removed
+	Into string
+}
+
+func (c Change) String() string {
+	if c.Into == "" {
+		return fmt.Sprintf("%s %s", c.Action, c.Layer)
+	}
+	return fmt.Sprintf("%s %s into %s", c.Action, c.Layer, c.Into)
+}
+
+var (
+	convTypes      = []string{"CONVOLUTION", "Convolution"}
+	reluFuserTypes = []string{"CONVOLUTION", "Convolution", "INNER_PRODUCT", "InnerProduct"}
+	reluTypes      = []string{"RELU", "ReLU"}
+	noopTypes      = []string{"DROPOUT", "Dropout", "SPLIT", "Split"}
+)
+
+// Optimize rewrites the net for inference, once the trained layers have been
+// copied:
+//   - Dropout and Split layers, which do nothing at test time, are removed
+//   - BatchNorm and Scale layers following a Convolution are folded into the
+//     convolution weight and bias
+//   - ReLU layers following a Convolution or InnerProduct are fused into it
+//
+// It returns the list of changes, the outputs of the optimized net match the
+// outputs of the original net up to floating point rounding. The net is left
+// unchanged on error. Optimize modifies the net, so it must not run
+// concurrently with Forward, and trained layers can no longer be copied to it
+func (net *Net) Optimize() ([]Change, error) {
+	params := make([]*pb.LayerParameter, len(net.params))
+	copy(params, net.params)
+
+	changes := []Change{}
+	params, removed := removeNoops(params)
+	changes = append(changes, removed...)
+
+	// the layers with a ReLU fused by an earlier Optimize no longer compute
+	// their parameters alone, nothing more is folded or fused into them
+	params, folded, err := foldBatchNorm(params, net.fusedReLU)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, folded...)
+
+	params, fused, newSlopes := fuseReLU(params, net.fusedReLU)
+	changes = append(changes, fused...)
+
+	slopes := make(map[string]float64, len(net.fusedReLU)+len(newSlopes))
+	for name, negativeSlope := range net.fusedReLU {
+		slopes[name] = negativeSlope
+	}
+	for name, negativeSlope := range newSlopes {
+		slopes[name] = negativeSlope
+	}
+	if err := net.setLayers(params, slopes); err != nil {
+		return nil, fmt.Errorf("optimize: %s", err)
+	}
+	net.optimized = true
+
+	return changes, nil
+}
+
+// removeNoops removes the layers that copy their bottom at test time, the
+// readers of their tops read the bottom instead
+func removeNoops(params []*pb.LayerParameter) ([]*pb.LayerParameter, []Change) {
+	changes := []Change{}
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		if !isType(p, noopTypes...) || len(p.GetBottom()) != 1 {
+			continue
+		}
+
+		// the bottom is read in place of the tops by later layers, so it
+		// must not be written again
+		bottom := p.GetBottom()[0]
+		if writtenAfter(params, i, bottom) && !(len(p.GetTop()) == 1 && p.GetTop()[0] == bottom) {
+			continue
+		}
+
+		for _, top := range p.GetTop() {
+			params = renameAfter(params, i, top, bottom)
+		}
+		params = append(params[:i:i], params[i+1:]...)
+		changes = append(changes, Change{Action: "remove", Layer: p.GetName()})
+		i--
+	}
+
+	return params, changes
+}
+
+// foldBatchNorm folds BatchNorm and Scale layers into the Convolution they
+// follow, unless a ReLU is fused into the convolution
+func foldBatchNorm(params []*pb.LayerParameter, fused map[string]float64) ([]*pb.LayerParameter, []Change, error) {
+	changes := []Change{}
+	for i := 0; i < len(params); i++ {
+		if _, ok := fused[params[i].GetName()]; ok {
+			continue
+		}
+		if !isType(params[i], convTypes...) || len(params[i].GetBlobs()) == 0 {
+			continue
+		}
+
+		for {
+			j, ok := soleReader(params, i)
+			if !ok {
+				break
+			}
+
+			next := params[j]
+			var conv *pb.LayerParameter
+			var err error
+			switch {
+			case isType(next, "BatchNorm"):
+				conv, err = foldBN(params[i], next)
+			case isType(next, "Scale"):
+				conv, err = foldScale(params[i], next)
+			default:
+				err = errNotFoldable
+			}
+			if err == errNotFoldable {
+				break
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("optimize: fold %s into %s: %s", next.GetName(), params[i].GetName(), err)
+			}
+
+			conv.Top = next.GetTop()
+			params[i] = conv
+			params = append(params[:j:j], params[j+1:]...)
+			changes = append(changes, Change{Action: "fold", Layer: next.GetName(), Into: conv.GetName()})
+		}
+	}
+
+	return params, changes, nil
+}
+
+// fuseReLU removes the ReLU layers following a Convolution or InnerProduct
+// without a fused ReLU, it returns the negative slope of the removed ReLU for
+// each layer they must be fused into
+func fuseReLU(params []*pb.LayerParameter, fused map[string]float64) ([]*pb.LayerParameter, []Change, map[string]float64) {
+	changes := []Change{}
+	slopes := make(map[string]float64)
+	for i := 0; i < len(params); i++ {
+		if _, ok := fused[params[i].GetName()]; ok || !isType(params[i], reluFuserTypes...) {
+			continue
+		}
+
+		j, ok := soleReader(params, i)
+		if !ok || !isType(params[j], reluTypes...) {
+			continue
+		}
+
+		relu := params[j]
+		p := proto.Clone(params[i]).(*pb.LayerParameter)
+		p.Top = relu.GetTop()
+		params[i] = p
+		params = append(params[:j:j], params[j+1:]...)
+		slopes[p.GetName()] = float64(relu.GetReluParam().GetNegativeSlope())
+		changes = append(changes, Change{Action: "fuse", Layer: relu.GetName(), Into: p.GetName()})
+	}
+
+	return params, changes, slopes
+}
+
+// errNotFoldable reports a layer which cannot be folded into the convolution
+var errNotFoldable = errors.New("layer cannot be folded")
+
+// foldBN returns the convolution parameters with the BatchNorm statistics
+// folded into its weight and bias:
+//
+//	w' = w / sqrt(var + eps), b' = (b - mean) / sqrt(var + eps)
+func foldBN(conv, bn *pb.LayerParameter) (*pb.LayerParameter, error) {
+	bnParam := bn.GetBatchNormParam()
+	if (bnParam != nil && bnParam.UseGlobalStats != nil && !bnParam.GetUseGlobalStats()) ||
+		len(bn.GetBlobs()) != 3 || len(bn.GetBottom()) != 1 {
+		return nil, errNotFoldable
+	}
+
+	blobs, err := blobsFromProto(bn.GetBlobs())
+	if err != nil {
+		return nil, err
+	}
+
+	// the statistics are stored multiplied by the moving average factor
+	factor := blobs[2].Data()[0]
+	if factor != 0 {
+		factor = 1 / factor
+	}
+	eps := float64(bnParam.GetEps())
+
+	mean := blobs[0].Data()
+	variance := blobs[1].Data()
+	scale := make([]float64, len(mean))
+	shift := make([]float64, len(mean))
+	for c := range mean {
+		scale[c] = 1 / math.Sqrt(variance[c]*factor+eps)
+		shift[c] = -mean[c] * factor * scale[c]
+	}
+
+	return scaleConv(conv, scale, shift)
+}
+
+// foldScale returns the convolution parameters with the learned Scale
+// parameters folded into its weight and bias:
+//
+//	w' = gamma * w, b' = gamma * b + beta
+func foldScale(conv, scale *pb.LayerParameter) (*pb.LayerParameter, error) {
+	scaleParam := scale.GetScaleParam()
+	if len(scale.GetBottom()) != 1 || len(scale.GetBlobs()) == 0 ||
+		scaleParam.GetAxis() != 1 || scaleParam.GetNumAxes() != 1 {
+		return nil, errNotFoldable
+	}
+
+	blobs, err := blobsFromProto(scale.GetBlobs())
+	if err != nil {
+		return nil, err
+	}
+
+	gamma := blobs[0].Data()
+	beta := make([]float64, len(gamma))
+	if scaleParam.GetBiasTerm() {
+		if len(blobs) < 2 {
+			return nil, errNotFoldable
+		}
+		copy(beta, blobs[1].Data())
+	}
+
+	return scaleConv(conv, gamma, beta)
+}
+
+// scaleConv returns a copy of the convolution parameters with the output
+// channel o computing scale[o] * conv + shift[o]
+func scaleConv(conv *pb.LayerParameter, scale, shift []float64) (*pb.LayerParameter, error) {
+	p := proto.Clone(conv).(*pb.LayerParameter)
+	numOutput := int(p.GetConvolutionParam().GetNumOutput())
+	if len(scale) != numOutput || len(shift) != numOutput {
+		return nil, fmt.Errorf("%d channels mismatch num_output %d", len(scale), numOutput)
+	}
+
+	blobs, err := blobsFromProto(p.GetBlobs())
+	if err != nil {
+		return nil, err
+	}
+
+	weight := blobs[0].Data()
+	size := len(weight) / numOutput
+	for o := 0; o < numOutput; o++ {
+		for k := 0; k < size; k++ {
+			weight[o*size+k] *= scale[o]
+		}
+	}
+
+	if !p.GetConvolutionParam().GetBiasTerm() || len(blobs) < 2 {
+		bias, err := blob.New([]int64{int64(numOutput)})
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs[:1], bias)
+		p.ConvolutionParam.BiasTerm = proto.Bool(true)
+	}
+	bias := blobs[1].Data()
+	for o := 0; o < numOutput; o++ {
+		bias[o] = bias[o]*scale[o] + shift[o]
+	}
+
+	p.Blobs = []*pb.BlobProto{blobProto(blobs[0]), blobProto(blobs[1])}
+	return p, nil
+}
+
+// soleReader returns the index of the only layer reading the top of layer i,
+// when layer i has a single top read by a single layer with a single bottom
+// and tops
+func soleReader(params []*pb.LayerParameter, i int) (int, bool) {
+	if len(params[i].GetTop()) != 1 {
+		return 0, false
+	}
+	top := params[i].GetTop()[0]
+
+	reader := -1
+	for j := i + 1; j < len(params); j++ {
+		if contains(params[j].GetBottom(), top) {
+			if reader >= 0 {
+				return 0, false
+			}
+			reader = j
+		}
+		// an in-place reader rewrites the blob, later readers see its top
+		if reader >= 0 && contains(params[j].GetTop(), top) {
+			break
+		}
+	}
+
+	if reader < 0 || len(params[reader].GetBottom()) != 1 || len(params[reader].GetTop()) != 1 {
+		return 0, false
+	}
+
+	// a reader writing another blob leaves the top for later readers
+	if params[reader].GetTop()[0] != top {
+		for j := reader + 1; j < len(params); j++ {
+			if contains(params[j].GetBottom(), top) {
+				return 0, false
+			}
+		}
+	}
+
+	return reader, true
+}
+
+// renameAfter renames the bottom blob from to to in the layers after i, until
+// from is written again
+func renameAfter(params []*pb.LayerParameter, i int, from, to string) []*pb.LayerParameter {
+	if from == to {
+		return params
+	}
+
+	for j := i + 1; j < len(params); j++ {
+		if contains(params[j].GetBottom(), from) {
+			p := proto.Clone(params[j]).(*pb.LayerParameter)
+			for k, v := range p.Bottom {
+				if v == from {
+					p.Bottom[k] = to
+				}
+			}
+			params[j] = p
+		}
+		if contains(params[j].GetTop(), from) {
+			break
+		}
+	}
+
+	return params
+}
+
+// writtenAfter returns whether a layer after i writes the blob
+func writtenAfter(params []*pb.LayerParameter, i int, name string) bool {
+	for j := i + 1; j < len(params); j++ {
+		if contains(params[j].GetTop(), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isType(param *pb.LayerParameter, types ...string) bool {
+	return contains(types, param.GetType())
+}
+
+// remove returns the list without the string s
+func remove(list []string, s string) []string {
+	result := list[:0:0]
+	for _, v := range list {
+		if v != s {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func blobsFromProto(protos []*pb.BlobProto) ([]*blob.Blob, error) {
+	blobs := make([]*blob.Blob, len(protos))
+	for i, v := range protos {
+		b, err := blob.FromProto(v)
+		if err != nil {
+			return nil, err
+		}
+		blobs[i] = b
+	}
+
+	return blobs, nil
+}
+
+func blobProto(b *blob.Blob) *pb.BlobProto {
+	return &pb.BlobProto{
+		Shape:      &pb.BlobShape{Dim: b.Shape()},
+		DoubleData: b.Data(),
+	}
+}
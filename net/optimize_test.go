@@ -0,0 +1,368 @@
+package net
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+const batchNormDeploy = `
+name: "batchnorm"
+input: "data"
+input_shape {
+  dim: 1
+  dim: 2
+  dim: 2
+  dim: 2
+}
+layer {
+  name: "conv1"
+  type: "Convolution"
+  bottom: "data"
+  top: "conv1"
+  convolution_param {
+    num_output: 2
+    kernel_size: 1
+  }
+}
+layer {
+  name: "bn1"
+  type: "BatchNorm"
+  bottom: "conv1"
+  top: "conv1"
+}
+layer {
+  name: "scale1"
+  type: "Scale"
+  bottom: "conv1"
+  top: "conv1"
+  scale_param {
+    bias_term: true
+  }
+}
+layer {
+  name: "relu1"
+  type: "ReLU"
+  bottom: "conv1"
+  top: "conv1"
+}
+layer {
+  name: "drop1"
+  type: "Dropout"
+  bottom: "conv1"
+  top: "conv1"
+  dropout_param {
+    dropout_ratio: 0.5
+  }
+}
+`
+
+func shapeBlobProto(shape []int64, data []float32) *pb.BlobProto {
+	return &pb.BlobProto{
+		Shape: &pb.BlobShape{Dim: shape},
+		Data:  data,
+	}
+}
+
+func TestOptimizeBatchNorm(t *testing.T) {
+	net, err := New(batchNormDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weight := []float32{1, -2, 0.5, 3}
+	bias := []float32{0.5, -1}
+	mean := []float32{2, -4}
+	variance := []float32{8, 2}
+	factor := float32(2)
+	gamma := []float32{1.5, -0.5}
+	beta := []float32{0.25, 1}
+
+	trained := &pb.NetParameter{}
+	if err := proto.UnmarshalText(batchNormDeploy, trained); err != nil {
+		t.Fatal(err)
+	}
+	layers := trained.GetLayer()
+	layers[0].Blobs = []*pb.BlobProto{
+		shapeBlobProto([]int64{2, 2, 1, 1}, weight),
+		shapeBlobProto([]int64{2}, bias),
+	}
+	layers[1].Blobs = []*pb.BlobProto{
+		shapeBlobProto([]int64{2}, mean),
+		shapeBlobProto([]int64{2}, variance),
+		shapeBlobProto([]int64{1}, []float32{factor}),
+	}
+	layers[2].Blobs = []*pb.BlobProto{
+		shapeBlobProto([]int64{2}, gamma),
+		shapeBlobProto([]int64{2}, beta),
+	}
+	if err := net.CopyTrainedLayersFromParam(trained); err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := blob.New([]int64{1, 2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := input.Data()
+	for i := range data {
+		data[i] = float64(i) - 3.5
+	}
+
+	original, err := net.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := net.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectChanges := []string{"remove drop1", "fold bn1 into conv1", "fold scale1 into conv1", "fuse relu1 into conv1"}
+	if len(changes) != len(expectChanges) {
+		t.Fatalf("changes %v, expect %v", changes, expectChanges)
+	}
+	for i, c := range changes {
+		if c.String() != expectChanges[i] {
+			t.Fatalf("changes %v, expect %v", changes, expectChanges)
+		}
+	}
+	if len(net.layers) != 1 {
+		t.Fatalf("optimized net has %d layers, expect 1", len(net.layers))
+	}
+
+	top, err := net.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eps := 1e-5
+	for o := 0; o < 2; o++ {
+		for h := 0; h < 2; h++ {
+			for w := 0; w < 2; w++ {
+				conv := float64(bias[o])
+				for c := 0; c < 2; c++ {
+					conv += input.Get([]int{0, c, h, w}) * float64(weight[o*2+c])
+				}
+				bn := (conv - float64(mean[o]/factor)) / math.Sqrt(float64(variance[o]/factor)+eps)
+				expect := math.Max(float64(gamma[o])*bn+float64(beta[o]), 0)
+				if v := top[0].Get([]int{0, o, h, w}); math.Abs(v-expect) > 1e-6 {
+					t.Fatalf("optimized output %f at (%d, %d, %d), expect %f", v, o, h, w, expect)
+				}
+				if v := original[0].Get([]int{0, o, h, w}); math.Abs(v-expect) > 1e-6 {
+					t.Fatalf("original output %f at (%d, %d, %d), expect %f", v, o, h, w, expect)
+				}
+			}
+		}
+	}
+}
+
+func TestOptimizeMatchesOriginal(t *testing.T) {
+	deploy := concurrentDeploy + `
+layers {
+  name: "drop1"
+  type: DROPOUT
+  bottom: "pool1"
+  top: "drop1"
+  dropout_param {
+    dropout_ratio: 0.5
+  }
+}
+layers {
+  name: "fc1"
+  type: INNER_PRODUCT
+  bottom: "drop1"
+  top: "fc1"
+  inner_product_param {
+    num_output: 3
+    bias_filler {
+      type: "uniform"
+      min: -1
+    }
+  }
+}
+layers {
+  name: "relu2"
+  type: RELU
+  bottom: "fc1"
+  top: "fc1"
+  relu_param {
+    negative_slope: 0.1
+  }
+}
+`
+	_, input := newConcurrentNet(t)
+
+	original, err := New(deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := original.InitBlobs([]*blob.Blob{input}, 1); err != nil {
+		t.Fatal(err)
+	}
+	optimized, err := New(deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := optimized.InitBlobs([]*blob.Blob{input}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := optimized.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("changes %v, expect drop1 removed, relu1 and relu2 fused", changes)
+	}
+
+	expect, err := original.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := optimized.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range top[0].Data() {
+		if math.Abs(v-expect[0].Data()[i]) > 1e-9 {
+			t.Fatalf("optimized output %v, expect %v", top[0].Data(), expect[0].Data())
+		}
+	}
+
+	// optimizing again rebuilds the layers with the ReLUs fused before
+	changes, err = optimized.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("changes %v, expect none", changes)
+	}
+	top, err = optimized.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range top[0].Data() {
+		if math.Abs(v-expect[0].Data()[i]) > 1e-9 {
+			t.Fatalf("optimized twice output %v, expect %v", top[0].Data(), expect[0].Data())
+		}
+	}
+
+	// trained layers no longer match the fused layers
+	if err := optimized.CopyTrainedLayersFromParam(original.Parameters); err == nil {
+		t.Fatal("expect error copying trained layers to an optimized net")
+	}
+}
+
+func TestOptimizeTwiceKeepsBatchNormAfterReLU(t *testing.T) {
+	deploy := `
+name: "relu_batchnorm"
+input: "data"
+input_shape {
+  dim: 1
+  dim: 2
+  dim: 2
+  dim: 2
+}
+layer {
+  name: "conv1"
+  type: "Convolution"
+  bottom: "data"
+  top: "conv1"
+  convolution_param {
+    num_output: 2
+    kernel_size: 1
+  }
+}
+layer {
+  name: "relu1"
+  type: "ReLU"
+  bottom: "conv1"
+  top: "conv1"
+}
+layer {
+  name: "bn1"
+  type: "BatchNorm"
+  bottom: "conv1"
+  top: "conv1"
+}
+layer {
+  name: "scale1"
+  type: "Scale"
+  bottom: "conv1"
+  top: "conv1"
+  scale_param {
+    bias_term: true
+  }
+}
+`
+	net, err := New(deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trained := &pb.NetParameter{}
+	if err := proto.UnmarshalText(deploy, trained); err != nil {
+		t.Fatal(err)
+	}
+	layers := trained.GetLayer()
+	layers[0].Blobs = []*pb.BlobProto{
+		shapeBlobProto([]int64{2, 2, 1, 1}, []float32{1, -2, 0.5, 3}),
+		shapeBlobProto([]int64{2}, []float32{0.5, -1}),
+	}
+	layers[2].Blobs = []*pb.BlobProto{
+		shapeBlobProto([]int64{2}, []float32{2, -4}),
+		shapeBlobProto([]int64{2}, []float32{8, 2}),
+		shapeBlobProto([]int64{1}, []float32{2}),
+	}
+	layers[3].Blobs = []*pb.BlobProto{
+		shapeBlobProto([]int64{2}, []float32{1.5, -0.5}),
+		shapeBlobProto([]int64{2}, []float32{0.25, 1}),
+	}
+	if err := net.CopyTrainedLayersFromParam(trained); err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := blob.New([]int64{1, 2, 2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range input.Data() {
+		input.Data()[i] = float64(i) - 3.5
+	}
+	expect, err := net.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the BatchNorm reads the ReLU output, it cannot be folded into the
+	// convolution once the ReLU is fused into it
+	for _, expectChanges := range [][]string{{"fuse relu1 into conv1"}, {}} {
+		changes, err := net.Optimize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != len(expectChanges) {
+			t.Fatalf("changes %v, expect %v", changes, expectChanges)
+		}
+		for i, c := range changes {
+			if c.String() != expectChanges[i] {
+				t.Fatalf("changes %v, expect %v", changes, expectChanges)
+			}
+		}
+
+		top, err := net.Forward([]*blob.Blob{input})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range top[0].Data() {
+			if math.Abs(v-expect[0].Data()[i]) > 1e-9 {
+				t.Fatalf("optimized output %v, expect %v", top[0].Data(), expect[0].Data())
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/cvley/gocaffe/layer"
+)
+
+// graph is the data flow of the layers of a net. Every write of a blob name
+// is a slot, so a layer reading a blob depends only on the layer writing the
+// slot it reads, even when the name is written again by later layers
+type graph struct {
+	// slots is the number of slots
+	slots int
+	// inputs is the slot of each net input
+	inputs []int
+	// bottoms and tops are the slots read and written by each layer
+	bottoms [][]int
+	tops    [][]int
+	// writer is the layer writing each slot, -1 for net inputs
+	writer []int
+	// outputs are the slots of the net outputs
+	outputs []int
+}
+
+func newGraph(layers []layer.Layer, inputs, outputs []string) *graph {
+	g := &graph{
+		bottoms: make([][]int, len(layers)),
+		tops:    make([][]int, len(layers)),
+	}
+
+	current := make(map[string]int)
+	for _, name := range inputs {
+		current[name] = g.slots
+		g.inputs = append(g.inputs, g.slots)
+		g.writer = append(g.writer, -1)
+		g.slots++
+	}
+
+	for i, l := range layers {
+		for _, name := range l.Bottom() {
+			s, exist := current[name]
+			if !exist {
+				s = -1
+			}
+			g.bottoms[i] = append(g.bottoms[i], s)
+		}
+		for _, name := range l.Top() {
+			current[name] = g.slots
+			g.tops[i] = append(g.tops[i], g.slots)
+			g.writer = append(g.writer, i)
+			g.slots++
+		}
+	}
+
+	for _, name := range outputs {
+		g.outputs = append(g.outputs, current[name])
+	}
+
+	return g
+}
+
+// SetWorkers sets the number of goroutines running the layers of the net in
+// Forward. With more than one worker, layers whose bottoms are ready run
+// concurrently, e.g. the branches of an Inception module, hooks must then be
+// safe for concurrent use. The outputs do not depend on the number of workers.
+// Workers below 1 run the layers in sequence, which is the default.
+// SetWorkers must not run concurrently with Forward
+func (net *Net) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	net.workers = n
+}
+
+// Workers returns the number of goroutines running the layers of the net
+func (net *Net) Workers() int {
+	if net.workers < 1 {
+		return 1
+	}
+	return net.workers
+}
+
+// job is a layer ready to run with its bottoms
+type job struct {
+	layer  int
+	bottom []*blob.Blob
+}
+
+// done is the result of a job
+type done struct {
+	layer int
+	top   []*blob.Blob
+	err   error
+}
+
+// forwardParallel is forward running the layers up to index end included on
+// the workers of the net, a layer starts as soon as the layers writing its
+// bottoms are done. When a layer fails, the layers not started are skipped,
+// the running ones are cancelled and the error of the first layer in net
+// order which did not fail because of the cancellation is returned
+func (net *Net) forwardParallel(ctx context.Context, bottom []*blob.Blob, end int, beforeHooks, afterHooks []Hook) ([]*blob.Blob, error) {
+	if !net.checkBottomShape(bottom[0]) {
+		return nil, fmt.Errorf("bottom shape %v mismatch net input dim %v", bottom[0].Shape(), net.inputDim)
+	}
+
+	g := net.graph
+	last := len(net.layers) - 1
+	if end < last {
+		last = end
+	}
+
+	slots := make([]*blob.Blob, g.slots)
+	for i, s := range g.inputs {
+		if i < len(bottom) {
+			slots[s] = bottom[i]
+		}
+	}
+
+	// waiting counts the layers each layer waits for, readers the layers
+	// still to read each slot
+	waiting := make([]int, last+1)
+	dependents := make([][]int, last+1)
+	readers := make([]int, g.slots)
+	for i := 0; i <= last; i++ {
+		for k, s := range g.bottoms[i] {
+			if s < 0 || (g.writer[s] < 0 && slots[s] == nil) {
+				return nil, fmt.Errorf("layer forward %s: bottom %s not found", net.layers[i].Type(), net.layers[i].Bottom()[k])
+			}
+			readers[s]++
+			if w := g.writer[s]; w >= 0 {
+				waiting[i]++
+				dependents[w] = append(dependents[w], i)
+			}
+		}
+	}
+
+	// with a memory plan, tops are allocated from a pool recycling the
+	// storage of slots without readers left
+	var pool *blob.Pool
+	if net.plan != nil {
+		pool = newPool()
+		ctx = blob.WithPool(ctx, pool)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan job, last+1)
+	results := make(chan done, last+1)
+	for w := 0; w < net.Workers(); w++ {
+		go func() {
+			for j := range jobs {
+				top, err := net.forwardLayer(ctx, net.layers[j.layer], j.bottom, beforeHooks, afterHooks)
+				results <- done{layer: j.layer, top: top, err: err}
+			}
+		}()
+	}
+	defer close(jobs)
+
+	// the slots read by a layer are written before it is dispatched, and
+	// kept until it is done
+	dispatch := func(i int) {
+		bottoms := make([]*blob.Blob, len(g.bottoms[i]))
+		for k, s := range g.bottoms[i] {
+			bottoms[k] = slots[s]
+		}
+		jobs <- job{layer: i, bottom: bottoms}
+	}
+
+	running := 0
+	for i := 0; i <= last; i++ {
+		if waiting[i] == 0 {
+			dispatch(i)
+			running++
+		}
+	}
+
+	var failed *done
+	for running > 0 {
+		r := <-results
+		running--
+
+		if r.err != nil {
+			// errors of layers cancelled after another one failed are
+			// not reported
+			cancelled := failed != nil && errors.Is(r.err, context.Canceled)
+			if !cancelled && (failed == nil || r.layer < failed.layer) {
+				failed = &r
+			}
+			cancel()
+			continue
+		}
+		if failed != nil {
+			continue
+		}
+
+		l := net.layers[r.layer]
+		if len(r.top) < len(g.tops[r.layer]) {
+			failed = &done{layer: r.layer, err: fmt.Errorf("layer forward %s: %d tops, expect %d", l.Type(), len(r.top), len(g.tops[r.layer]))}
+			cancel()
+			continue
+		}
+		for k, s := range g.tops[r.layer] {
+			slots[s] = r.top[k]
+		}
+
+		if pool != nil {
+			for _, s := range g.bottoms[r.layer] {
+				readers[s]--
+				if readers[s] == 0 && g.writer[s] >= 0 {
+					b := slots[s]
+					slots[s] = nil
+					if !shares(b, slots) {
+						pool.Release(b)
+					}
+				}
+			}
+		}
+
+		for _, d := range dependents[r.layer] {
+			waiting[d]--
+			if waiting[d] == 0 {
+				dispatch(d)
+				running++
+			}
+		}
+	}
+
+	if failed != nil {
+		return nil, failed.err
+	}
+
+	if end <= last {
+		top := make([]*blob.Blob, len(g.tops[end]))
+		for k, s := range g.tops[end] {
+			top[k] = slots[s]
+		}
+		return top, nil
+	}
+
+	top := make([]*blob.Blob, len(g.outputs))
+	for i, s := range g.outputs {
+		top[i] = slots[s]
+	}
+
+	return top, nil
+}
@@ -0,0 +1,131 @@
+package net
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/cvley/gocaffe/layer"
+)
+
+const branchDeploy = `
+name: "branch"
+input: "data"
+input_dim: 1
+input_dim: 2
+input_dim: 3
+input_dim: 3
+layers {
+  name: "conv_a"
+  type: CONVOLUTION
+  bottom: "data"
+  top: "conv_a"
+  convolution_param {
+    num_output: 2
+    kernel_size: 1
+  }
+}
+layers {
+  name: "conv_b"
+  type: CONVOLUTION
+  bottom: "data"
+  top: "conv_b"
+  convolution_param {
+    num_output: 3
+    kernel_size: 1
+  }
+}
+layers {
+  name: "relu_a"
+  type: RELU
+  bottom: "conv_a"
+  top: "conv_a"
+}
+layers {
+  name: "pool_b"
+  type: POOLING
+  bottom: "conv_b"
+  top: "pool_b"
+  pooling_param {
+    pool: AVE
+    global_pooling: true
+  }
+}
+layers {
+  name: "relu_b"
+  type: RELU
+  bottom: "conv_b"
+  top: "relu_b"
+}
+`
+
+func newBranchNet(t *testing.T) (*Net, *blob.Blob) {
+	_, input := newConcurrentNet(t)
+
+	net, err := New(branchDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.InitBlobs([]*blob.Blob{input}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	return net, input
+}
+
+func TestForwardWorkers(t *testing.T) {
+	net, input := newBranchNet(t)
+
+	expect, err := net.Forward([]*blob.Blob{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expect) != 3 {
+		t.Fatalf("%d outputs, expect conv_a, pool_b and relu_b", len(expect))
+	}
+
+	net.SetWorkers(4)
+	if _, err := net.PlanMemory([]*blob.Blob{input}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		top, err := net.Forward([]*blob.Blob{input})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(top) != len(expect) {
+			t.Fatalf("%d outputs, expect %d", len(top), len(expect))
+		}
+		for j := range top {
+			if top[j].DataString() != expect[j].DataString() {
+				t.Fatalf("output %d is %s with 4 workers, expect %s", j, top[j].DataString(), expect[j].DataString())
+			}
+		}
+	}
+
+	top, err := net.ForwardFromTo([]*blob.Blob{input}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top[0].Channels() != 3 {
+		t.Fatalf("forward to conv_b returns %d channels, expect 3", top[0].Channels())
+	}
+}
+
+func TestForwardWorkersError(t *testing.T) {
+	net, input := newBranchNet(t)
+	net.SetWorkers(4)
+
+	errBranch := errors.New("branch failed")
+	net.AddBeforeForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		if l.Type() == "pool_b" {
+			return errBranch
+		}
+		return nil
+	})
+
+	_, err := net.Forward([]*blob.Blob{input})
+	if !errors.Is(err, errBranch) {
+		t.Fatalf("expect error of branch pool_b, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package net
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+// upgradeV1Layer converts a layer in the deprecated V1 format to a
+// LayerParameter, as UpgradeV1LayerParameter of caffe/util/upgrade_proto.cpp.
+// The V1 enum name, e.g. CONVOLUTION, is kept as layer type, the registry
+// knows the layers under both names
+func upgradeV1Layer(v1 *pb.V1LayerParameter) *pb.LayerParameter {
+	return &pb.LayerParameter{
+		Name:                 v1.Name,
+		Type:                 proto.String(v1.GetType().String()),
+		Bottom:               v1.Bottom,
+		Top:                  v1.Top,
+		Blobs:                v1.Blobs,
+		LossWeight:           v1.LossWeight,
+		Include:              v1.Include,
+		Exclude:              v1.Exclude,
+		TransformParam:       v1.TransformParam,
+		LossParam:            v1.LossParam,
+		AccuracyParam:        v1.AccuracyParam,
+		ArgmaxParam:          v1.ArgmaxParam,
+		ConcatParam:          v1.ConcatParam,
+		ContrastiveLossParam: v1.ContrastiveLossParam,
+		ConvolutionParam:     v1.ConvolutionParam,
+		DataParam:            v1.DataParam,
+		DropoutParam:         v1.DropoutParam,
+		DummyDataParam:       v1.DummyDataParam,
+		EltwiseParam:         v1.EltwiseParam,
+		ExpParam:             v1.ExpParam,
+		Hdf5DataParam:        v1.Hdf5DataParam,
+		Hdf5OutputParam:      v1.Hdf5OutputParam,
+		HingeLossParam:       v1.HingeLossParam,
+		ImageDataParam:       v1.ImageDataParam,
+		InfogainLossParam:    v1.InfogainLossParam,
+		InnerProductParam:    v1.InnerProductParam,
+		LrnParam:             v1.LrnParam,
+		MemoryDataParam:      v1.MemoryDataParam,
+		MvnParam:             v1.MvnParam,
+		PoolingParam:         v1.PoolingParam,
+		PowerParam:           v1.PowerParam,
+		ReluParam:            v1.ReluParam,
+		SigmoidParam:         v1.SigmoidParam,
+		SoftmaxParam:         v1.SoftmaxParam,
+		SliceParam:           v1.SliceParam,
+		TanhParam:            v1.TanhParam,
+		ThresholdParam:       v1.ThresholdParam,
+		WindowDataParam:      v1.WindowDataParam,
+	}
+}
+
+// layerParams returns the layers of the net parameters, layers in the V1
+// format are upgraded
+func layerParams(param *pb.NetParameter) []*pb.LayerParameter {
+	if len(param.GetLayer()) > 0 {
+		return param.GetLayer()
+	}
+
+	params := make([]*pb.LayerParameter, len(param.GetLayers()))
+	for i, v := range param.GetLayers() {
+		params[i] = upgradeV1Layer(v)
+	}
+
+	return params
+}
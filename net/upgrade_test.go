@@ -0,0 +1,137 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/cvley/gocaffe/proto"
+)
+
+const v1Deploy = `
+name: "v1"
+input: "data"
+input_dim: 1
+input_dim: 2
+input_dim: 3
+input_dim: 3
+layers {
+  name: "conv1"
+  type: CONVOLUTION
+  bottom: "data"
+  top: "conv1"
+  convolution_param {
+    num_output: 2
+    kernel_size: 1
+  }
+}
+layers {
+  name: "relu1"
+  type: RELU
+  bottom: "conv1"
+  top: "conv1"
+}
+`
+
+const inputLayerDeploy = `
+name: "input"
+layer {
+  name: "data"
+  type: "Input"
+  top: "data"
+  input_param {
+    shape {
+      dim: 1
+      dim: 2
+      dim: 3
+      dim: 3
+    }
+  }
+}
+layer {
+  name: "conv1"
+  type: "Convolution"
+  bottom: "data"
+  top: "conv1"
+  convolution_param {
+    num_output: 2
+    kernel_size: 1
+  }
+}
+layer {
+  name: "relu1"
+  type: "ReLU"
+  bottom: "conv1"
+  top: "conv1"
+}
+`
+
+func TestUpgradeV1Layer(t *testing.T) {
+	param := &pb.NetParameter{}
+	if err := proto.UnmarshalText(v1Deploy, param); err != nil {
+		t.Fatal(err)
+	}
+
+	params := layerParams(param)
+	if len(params) != 2 {
+		t.Fatalf("%d layers, expect 2", len(params))
+	}
+	conv := params[0]
+	if conv.GetName() != "conv1" || conv.GetType() != "CONVOLUTION" {
+		t.Errorf("layer %s of type %s, expect conv1 of type CONVOLUTION", conv.GetName(), conv.GetType())
+	}
+	if len(conv.GetBottom()) != 1 || conv.GetBottom()[0] != "data" || len(conv.GetTop()) != 1 || conv.GetTop()[0] != "conv1" {
+		t.Errorf("bottom %v and top %v, expect [data] and [conv1]", conv.GetBottom(), conv.GetTop())
+	}
+	if conv.GetConvolutionParam().GetNumOutput() != 2 {
+		t.Errorf("num_output %d, expect 2", conv.GetConvolutionParam().GetNumOutput())
+	}
+	if params[1].GetType() != "RELU" {
+		t.Errorf("layer type %s, expect RELU", params[1].GetType())
+	}
+}
+
+func TestLayerParamsPreferCurrentFormat(t *testing.T) {
+	param := &pb.NetParameter{}
+	if err := proto.UnmarshalText(inputLayerDeploy, param); err != nil {
+		t.Fatal(err)
+	}
+
+	params := layerParams(param)
+	if len(params) != len(param.GetLayer()) {
+		t.Fatalf("%d layers, expect %d", len(params), len(param.GetLayer()))
+	}
+	for i, v := range params {
+		if v != param.GetLayer()[i] {
+			t.Errorf("layer %d is not the layer of the net parameters", i)
+		}
+	}
+}
+
+func TestNewFromInputLayer(t *testing.T) {
+	v1, err := New(v1Deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	net, err := New(inputLayerDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []*Net{v1, net} {
+		if len(n.input) != 1 || n.input[0] != "data" {
+			t.Errorf("net %s input %v, expect [data]", n.name, n.input)
+		}
+		if len(n.inputDim) != 4 || n.inputDim[1] != 2 || n.inputDim[3] != 3 {
+			t.Errorf("net %s input dim %v, expect [1 2 3 3]", n.name, n.inputDim)
+		}
+		// the Input layer only declares the input, no layer is created
+		if len(n.layerNames) != 2 || n.layerNames[0] != "conv1" || n.layerNames[1] != "relu1" {
+			t.Errorf("net %s layers %v, expect [conv1 relu1]", n.name, n.layerNames)
+		}
+	}
+
+	if _, err := New(`name: "none" layer { name: "conv1" type: "Convolution" }`); err == nil {
+		t.Error("expect error for a net without input")
+	}
+}
@@ -0,0 +1,225 @@
+// Command time benchmarks the forward pass of a net layer by layer, like the
+// time action of caffe/tools/caffe.cpp.
+//
+// The net is loaded from a deploy prototxt, with weights from a trained model
+// when -weights is given, or filled by the layer fillers otherwise. After the
+// warm-up iterations, the forward pass is run -iterations times on a random
+// input and the average forward time of every layer is printed, in text or in
+// JSON with -format json. With -optimize the net is optimized for inference
+// first, and the changes are reported. With -workers the independent layers
+// of the net run concurrently, their times then overlap.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cvley/gocaffe/blob"
+	"github.com/cvley/gocaffe/layer"
+	"github.com/cvley/gocaffe/net"
+)
+
+// LayerTime is the average forward time of one layer
+type LayerTime struct {
+	Name      string  `json:"name"`
+	ForwardMs float64 `json:"forward_ms"`
+}
+
+// Report is the result of the benchmark
+type Report struct {
+	Net        string      `json:"net"`
+	Iterations int         `json:"iterations"`
+	Warmup     int         `json:"warmup"`
+	Optimized  []string    `json:"optimized,omitempty"`
+	Layers     []LayerTime `json:"layers"`
+	ForwardMs  float64     `json:"forward_ms"`
+	TotalMs    float64     `json:"total_ms"`
+}
+
+func main() {
+	model := flag.String("model", "", "deploy prototxt file")
+	weights := flag.String("weights", "", "trained model, layers are filled by their fillers if empty")
+	iterations := flag.Int("iterations", 50, "number of timed iterations")
+	warmup := flag.Int("warmup", 1, "number of untimed warm-up iterations")
+	format := flag.String("format", "text", "output format, text or json")
+	seed := flag.Int64("seed", 1, "seed of the random input and weights")
+	optimize := flag.Bool("optimize", false, "optimize the net for inference before timing")
+	workers := flag.Int("workers", 1, "number of goroutines running independent layers")
+	verbose := flag.Bool("v", false, "keep the log output of the layers")
+	flag.Parse()
+
+	if *model == "" {
+		log.Println("invalid model file")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *iterations <= 0 || *warmup < 0 {
+		log.Println("invalid iterations or warmup")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *format != "text" && *format != "json" {
+		log.Println("invalid format", *format)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// layers log every forward, which would be timed as well
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	b, err := ioutil.ReadFile(*model)
+	if err != nil {
+		fatal(err)
+	}
+
+	n, err := net.New(string(b))
+	if err != nil {
+		fatal(err)
+	}
+
+	bottom, err := randomInput(n.GetInputShape(), *seed)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *weights != "" {
+		err = n.CopyTrainedLayersFromFile(*weights)
+	} else {
+		err = n.InitBlobs([]*blob.Blob{bottom}, *seed)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	optimized := []string{}
+	if *optimize {
+		changes, err := n.Optimize()
+		if err != nil {
+			fatal(err)
+		}
+		for _, c := range changes {
+			optimized = append(optimized, c.String())
+		}
+	}
+
+	n.SetWorkers(*workers)
+	report, err := benchmark(n, bottom, *iterations, *warmup)
+	if err != nil {
+		fatal(err)
+	}
+	report.Optimized = optimized
+
+	if *format == "json" {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	for _, c := range report.Optimized {
+		fmt.Printf("Optimized: %s.\n", c)
+	}
+	fmt.Printf("Testing for %d iterations, %d warm-up.\n", report.Iterations, report.Warmup)
+	for _, l := range report.Layers {
+		fmt.Printf("%20s\tforward: %.4f ms.\n", l.Name, l.ForwardMs)
+	}
+	fmt.Printf("Average Forward pass: %.4f ms.\n", report.ForwardMs)
+	fmt.Printf("Total Time: %.4f ms.\n", report.TotalMs)
+}
+
+// benchmark runs warmup untimed and iterations timed forward passes of the
+// net, timing every layer with forward hooks
+func benchmark(n *net.Net, bottom *blob.Blob, iterations, warmup int) (*Report, error) {
+	for i := 0; i < warmup; i++ {
+		if _, err := n.Forward([]*blob.Blob{bottom}); err != nil {
+			return nil, err
+		}
+	}
+
+	// with several workers the hooks run concurrently
+	var mu sync.Mutex
+	names := []string{}
+	elapsed := make(map[string]time.Duration)
+	start := make(map[string]time.Time)
+	n.AddBeforeForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		start[l.Type()] = time.Now()
+		return nil
+	})
+	n.AddAfterForward(func(l layer.Layer, bottom, top []*blob.Blob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, exist := elapsed[l.Type()]; !exist {
+			names = append(names, l.Type())
+		}
+		elapsed[l.Type()] += time.Since(start[l.Type()])
+		return nil
+	})
+
+	var forward time.Duration
+	for i := 0; i < iterations; i++ {
+		s := time.Now()
+		if _, err := n.Forward([]*blob.Blob{bottom}); err != nil {
+			return nil, err
+		}
+		forward += time.Since(s)
+	}
+
+	report := &Report{
+		Net:        n.Name(),
+		Iterations: iterations,
+		Warmup:     warmup,
+		Layers:     make([]LayerTime, len(names)),
+		ForwardMs:  milliseconds(forward) / float64(iterations),
+		TotalMs:    milliseconds(forward),
+	}
+	for i, name := range names {
+		report.Layers[i] = LayerTime{
+			Name:      name,
+			ForwardMs: milliseconds(elapsed[name]) / float64(iterations),
+		}
+	}
+
+	return report, nil
+}
+
+// randomInput returns a blob of the input shape with values uniformly
+// distributed in [-1, 1)
+func randomInput(shape []int64, seed int64) (*blob.Blob, error) {
+	b, err := blob.New(shape)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	data := b.Data()
+	for i := range data {
+		data[i] = rng.Float64()*2 - 1
+	}
+
+	return b, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// fatal prints err on stderr even when the log output is discarded
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -10,19 +10,45 @@ var (
 	floatZero = float64(0)
 )
 
-//TODO: use blob instead
+// OutputSize returns the number of positions of a kernel sliding with the
+// stride over the padded size, the kernel taps being dilation apart
+func OutputSize(size, kernel, pad, stride, dilation int) int {
+	return (size+2*pad-(dilation*(kernel-1)+1))/stride + 1
+}
+
+// Im2col returns the channels x height x width image data as the matrix of
+// channels*kernelH*kernelW rows and one column for every output position,
+// the column holding the window of the position, as Caffe's im2col_cpu
+// TODO: use blob instead
 func Im2col(data []float64, channels, height, width, kernelH, kernelW, padH, padW, strideH, strideW, dilationH, dilationW int) (blas64.General, error) {
+	outH := OutputSize(height, kernelH, padH, strideH, dilationH)
+	outW := OutputSize(width, kernelW, padW, strideW, dilationW)
+	if outH <= 0 || outW <= 0 {
+		return blas64.General{}, errors.New("kernel larger than the padded image")
+	}
+	return Im2colTo(make([]float64, outH*outW*channels*kernelH*kernelW), data, channels, height, width, kernelH, kernelW, padH, padW, strideH, strideW, dilationH, dilationW)
+}
+
+// Im2colTo is Im2col writing the matrix to dst, so one buffer can be reused
+// for every image, all of its values are overwritten
+func Im2colTo(dst, data []float64, channels, height, width, kernelH, kernelW, padH, padW, strideH, strideW, dilationH, dilationW int) (blas64.General, error) {
 	if len(data) < channels*width*height {
 		return blas64.General{}, errors.New("mismatch data length with channels*width*height")
 	}
 
-	outH := (height + padH*2 - (dilationH*(kernelH-1))/strideH) + 1
-	outW := (width + padW*2 - (dilationW*(kernelW-1))/strideW) + 1
+	outH := OutputSize(height, kernelH, padH, strideH, dilationH)
+	outW := OutputSize(width, kernelW, padW, strideW, dilationW)
+	if outH <= 0 || outW <= 0 {
+		return blas64.General{}, errors.New("kernel larger than the padded image")
+	}
+	if len(dst) < outH*outW*channels*kernelH*kernelW {
+		return blas64.General{}, errors.New("mismatch dst length with the column matrix size")
+	}
 	outData := blas64.General{
-		Cols:   outW,
-		Rows:   outH,
-		Stride: channels * kernelH * kernelW,
-		Data:   make([]float64, outH*outW*channels*kernelH*kernelW),
+		Rows:   channels * kernelH * kernelW,
+		Cols:   outH * outW,
+		Stride: outH * outW,
+		Data:   dst[:outH*outW*channels*kernelH*kernelW],
 	}
 
 	idx := 0
@@ -36,12 +62,15 @@ func Im2col(data []float64, channels, height, width, kernelH, kernelW, padH, pad
 						for outCol := 0; outCol < outW; outCol++ {
 							if inCol >= 0 && inCol < width {
 								outData.Data[idx] = data[inRow*width+inCol+channel*width*height]
+							} else {
+								outData.Data[idx] = floatZero
 							}
 							inCol += strideW
 							idx++
 						}
 					} else {
 						for outCol := 0; outCol < outW; outCol++ {
+							outData.Data[idx] = floatZero
 							idx++
 						}
 					}
@@ -54,9 +83,11 @@ func Im2col(data []float64, channels, height, width, kernelH, kernelW, padH, pad
 	return outData, nil
 }
 
+// Col2im is the reverse of Im2col, every column value is added back to the
+// image position it was taken from, as Caffe's col2im_cpu
 func Col2im(data blas64.General, channels, height, width, kernelH, kernelW, padH, padW, strideH, strideW, dilationH, dilationW int) ([]float64, error) {
-	outH := (height + padH*2 - (dilationH*(kernelH-1))/strideH) + 1
-	outW := (width + padW*2 - (dilationW*(kernelW-1))/strideW) + 1
+	outH := OutputSize(height, kernelH, padH, strideH, dilationH)
+	outW := OutputSize(width, kernelW, padW, strideW, dilationW)
 
 	if len(data.Data) < outH*outW*channels*kernelH*kernelW {
 		return nil, errors.New("invalid input data")
@@ -74,7 +105,7 @@ func Col2im(data blas64.General, channels, height, width, kernelH, kernelW, padH
 						inCol := -padW + kCol*dilationW
 						for outCol := 0; outCol < outW; outCol++ {
 							if inCol >= 0 && inCol < width {
-								output[inRow*width+inCol+channel*width*height] = data.Data[idx]
+								output[inRow*width+inCol+channel*width*height] += data.Data[idx]
 							}
 							inCol += strideW
 							idx++
@@ -26,3 +26,120 @@ func TestIm2Col(t *testing.T) {
 		}
 	}
 }
+
+func TestIm2ColWindows(t *testing.T) {
+	rangeData := func(n int) []float64 {
+		data := make([]float64, n)
+		for i := range data {
+			data[i] = float64(i)
+		}
+		return data
+	}
+
+	// channels, height, width, kernel, pad, stride and dilation as h, w
+	tests := []struct {
+		name           string
+		data           []float64
+		c, h, w        int
+		kH, kW, pH, pW int
+		sH, sW, dH, dW int
+		rows, cols     int
+		expect         []float64
+	}{
+		{
+			"padding", []float64{1, 2, 3, 4},
+			1, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1,
+			4, 9,
+			[]float64{
+				0, 0, 0, 0, 1, 2, 0, 3, 4,
+				0, 0, 0, 1, 2, 0, 3, 4, 0,
+				0, 1, 2, 0, 3, 4, 0, 0, 0,
+				1, 2, 0, 3, 4, 0, 0, 0, 0,
+			},
+		},
+		{
+			"stride", rangeData(16),
+			1, 4, 4, 2, 2, 0, 0, 2, 2, 1, 1,
+			4, 4,
+			[]float64{0, 2, 8, 10, 1, 3, 9, 11, 4, 6, 12, 14, 5, 7, 13, 15},
+		},
+		{
+			"dilation", rangeData(9),
+			1, 3, 3, 2, 2, 0, 0, 1, 1, 2, 2,
+			4, 1,
+			[]float64{0, 2, 6, 8},
+		},
+		{
+			"asymmetric", rangeData(24),
+			2, 3, 4, 1, 2, 0, 1, 2, 3, 1, 1,
+			4, 4,
+			[]float64{0, 2, 0, 10, 0, 3, 8, 11, 0, 14, 0, 22, 12, 15, 20, 23},
+		},
+	}
+
+	for _, test := range tests {
+		col, err := Im2col(test.data, test.c, test.h, test.w, test.kH, test.kW, test.pH, test.pW, test.sH, test.sW, test.dH, test.dW)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if col.Rows != test.rows || col.Cols != test.cols || col.Stride != test.cols {
+			t.Errorf("%s: %d x %d matrix with stride %d, expect %d x %d", test.name, col.Rows, col.Cols, col.Stride, test.rows, test.cols)
+			continue
+		}
+		for i, v := range col.Data {
+			if v != test.expect[i] {
+				t.Errorf("%s: data %v, expect %v", test.name, col.Data, test.expect)
+				break
+			}
+		}
+	}
+}
+
+func TestCol2ImAccumulates(t *testing.T) {
+	// every value is in the 4 windows of a 2 x 2 kernel padded by 1
+	col, err := Im2col([]float64{1, 2, 3, 4}, 1, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := Col2im(col, 1, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []float64{4, 8, 12, 16} {
+		if im[i] != v {
+			t.Fatalf("col2im %v, expect [4 8 12 16]", im)
+		}
+	}
+}
+
+func TestIm2ColKernelTooLarge(t *testing.T) {
+	if _, err := Im2col(make([]float64, 4), 1, 2, 2, 3, 3, 0, 0, 1, 1, 1, 1); err == nil {
+		t.Error("expect error for kernel larger than the image")
+	}
+}
+
+func TestIm2ColToReusedBuffer(t *testing.T) {
+	// a padded 2 x 2 kernel over a 2 x 2 image leaves padding in every column
+	expect, err := Im2col([]float64{1, 2, 3, 4}, 1, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := make([]float64, len(expect.Data))
+	for i := range dst {
+		dst[i] = -1
+	}
+	col, err := Im2colTo(dst, []float64{1, 2, 3, 4}, 1, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range expect.Data {
+		if col.Data[i] != v {
+			t.Fatalf("im2col to a used buffer %v, expect %v", col.Data, expect.Data)
+		}
+	}
+
+	if _, err := Im2colTo(dst[:len(dst)-1], []float64{1, 2, 3, 4}, 1, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1); err == nil {
+		t.Error("expect error for a too short buffer")
+	}
+}